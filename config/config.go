@@ -2,30 +2,150 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/CIDgravity/snakelet"
 )
 
+// Available sources used to find the last repositories created on Github
+const (
+	GithubSourceSearch = "search"
+	GithubSourceEvents = "events"
+)
+
+// ErrConfigNotFound is returned by Load when no config.toml file is found and no environment variable is set,
+// default values can still be used
+var ErrConfigNotFound = errors.New("config file config/config.toml not found and no SCLNG_ environment variable set")
+
 // Config will store the application config from config.toml file
 type Config struct {
-	API    APIConfig    `mapstructure:"API"`
-	Github GithubConfig `mapstructure:"GITHUB"`
-	Tasks  TasksConfig  `mapstructure:"TASKS"`
-	Logs   LogsConfig   `mapstructure:"LOGS"`
+	API           APIConfig           `mapstructure:"API"`
+	Github        GithubConfig        `mapstructure:"GITHUB"`
+	Tasks         TasksConfig         `mapstructure:"TASKS"`
+	Logs          LogsConfig          `mapstructure:"LOGS"`
+	Storage       StorageConfig       `mapstructure:"STORAGE"`
+	Searches      SearchesConfig      `mapstructure:"SEARCHES"`
+	Notifications NotificationsConfig `mapstructure:"NOTIFICATIONS"`
+	Breaker       BreakerConfig       `mapstructure:"CIRCUIT_BREAKER"`
+	Cache         CacheConfig         `mapstructure:"CACHE"`
+	Metrics       MetricsConfig       `mapstructure:"METRICS"`
+	Tracing       TracingConfig       `mapstructure:"TRACING"`
+	Health        HealthConfig        `mapstructure:"HEALTH"`
+	Quota         QuotaConfig         `mapstructure:"QUOTA"`
+	Auth          AuthConfig          `mapstructure:"AUTH"`
+	Lanes         LanesConfig         `mapstructure:"LANES"`
 }
 
 type APIConfig struct {
-	ListenPort string `mapstructure:"ListenPort"`
+	ListenPort     string `mapstructure:"ListenPort"`
+	RequestTimeout int    `mapstructure:"RequestTimeout"` // in seconds, 0 to disable
 }
 
 type TasksConfig struct {
 	MaxParallelTasksAllowed int `mapstructure:"MaxParallelTasksAllowed"`
+	MinParallelTasksAllowed int `mapstructure:"MinParallelTasksAllowed"`
+	InitialParallelTasks    int `mapstructure:"InitialParallelTasks"`
+	TargetLatency           int `mapstructure:"TargetLatency"` // in milliseconds, concurrency only grows below this latency
 }
 
 type GithubConfig struct {
-	Token string `mapstructure:"Token"`
+	Token              string `mapstructure:"Token"`
+	TokenFile          string `mapstructure:"TokenFile"`          // file containing the token, e.g. a mounted secret, takes precedence over Token
+	Source             string `mapstructure:"Source"`             // search | events
+	EventsPollInterval int    `mapstructure:"EventsPollInterval"` // in seconds, X-Poll-Interval from Github wins if greater
+	WebhookSecret      string `mapstructure:"WebhookSecret"`      // empty to disable the inbound webhook
+	RequestTimeout     int    `mapstructure:"RequestTimeout"`     // in seconds for each call to Github, 0 to disable
+	MaxAttempts        int    `mapstructure:"MaxAttempts"`        // 1 to disable retries
+	InitialBackoff     int    `mapstructure:"InitialBackoff"`     // in milliseconds, doubled after each attempt
+	MaxBackoff         int    `mapstructure:"MaxBackoff"`         // in milliseconds, a longer Retry-After from Github is not waited
+}
+
+type StorageConfig struct {
+	Enabled       bool   `mapstructure:"Enabled"`
+	Path          string `mapstructure:"Path"`
+	RetentionDays int    `mapstructure:"RetentionDays"` // 0 to keep everything
+}
+
+type SearchesConfig struct {
+	RunInterval int `mapstructure:"RunInterval"` // in seconds
+}
+
+type NotificationsConfig struct {
+	WebhookURL     string `mapstructure:"WebhookURL"` // empty to disable notifications
+	WebhookSecret  string `mapstructure:"WebhookSecret"`
+	MaxAttempts    int    `mapstructure:"MaxAttempts"`
+	InitialBackoff int    `mapstructure:"InitialBackoff"` // in milliseconds, doubled after each attempt
+	DeadLetterPath string `mapstructure:"DeadLetterPath"`
+}
+
+type BreakerConfig struct {
+	Enabled           bool `mapstructure:"Enabled"`
+	WindowSize        int  `mapstructure:"WindowSize"`        // number of last calls used to compute the error rate
+	MinimumCalls      int  `mapstructure:"MinimumCalls"`      // calls required in the window before the circuit can open
+	FailureRate       int  `mapstructure:"FailureRate"`       // in percent, failed or slow calls required to open the circuit
+	SlowCallThreshold int  `mapstructure:"SlowCallThreshold"` // in milliseconds, slower calls are counted as failures
+	OpenDuration      int  `mapstructure:"OpenDuration"`      // in seconds, before a single call is allowed to test Github again
+}
+
+type CacheConfig struct {
+	MaxAge     int `mapstructure:"MaxAge"`     // in seconds, of results served when Github is unavailable, 0 to disable
+	MaxEntries int `mapstructure:"MaxEntries"` // searches kept, the least recently used ones are evicted
+}
+
+type MetricsConfig struct {
+	Enabled bool `mapstructure:"Enabled"` // exposes Prometheus metrics on /metrics
+}
+
+type TracingConfig struct {
+	Exporter     string  `mapstructure:"Exporter"`     // none | stdout | file | otlp
+	FilePath     string  `mapstructure:"FilePath"`     // spans written as JSON lines with the file exporter
+	OTLPEndpoint string  `mapstructure:"OTLPEndpoint"` // host:port of the OTLP HTTP collector
+	OTLPInsecure bool    `mapstructure:"OTLPInsecure"` // plain HTTP to the collector
+	SampleRatio  float64 `mapstructure:"SampleRatio"`  // between 0 and 1, sampled traces from incoming requests are always kept
+}
+
+type HealthConfig struct {
+	GithubCheckInterval int `mapstructure:"GithubCheckInterval"` // in seconds, minimum delay between two checks of Github by /readyz
+}
+
+type QuotaConfig struct {
+	CoreLowWaterMark   int `mapstructure:"CoreLowWaterMark"`   // percentage of the core limit remaining under which /repos is served from cache only, 0 to disable
+	SearchLowWaterMark int `mapstructure:"SearchLowWaterMark"` // percentage of the search limit remaining under which /repos is served from cache only, 0 to disable
+}
+
+type AuthConfig struct {
+	Enabled                bool           `mapstructure:"Enabled"`                // API key or bearer token required on all routes except probes, metrics and the Github webhook
+	DefaultRequestsPerHour int            `mapstructure:"DefaultRequestsPerHour"` // Github requests allowed per hour for keys without their own quota, and for each token subject
+	Keys                   []APIKeyConfig `mapstructure:"Keys"`
+	JWKSFile               string         `mapstructure:"JWKSFile"`            // path of the JWKS used to verify bearer tokens, takes precedence over JWKSURL
+	JWKSURL                string         `mapstructure:"JWKSURL"`             // URL of the JWKS used to verify bearer tokens
+	JWKSRefreshInterval    int            `mapstructure:"JWKSRefreshInterval"` // in seconds, delay after which the JWKS is loaded again
+	JWTIssuer              string         `mapstructure:"JWTIssuer"`           // expected iss claim of bearer tokens
+	JWTAudience            string         `mapstructure:"JWTAudience"`         // expected aud claim of bearer tokens
+}
+
+// APIKeyConfig is an API key declared in the config file, only the SHA-256 hash of the key is kept
+type APIKeyConfig struct {
+	Name            string `mapstructure:"Name"`
+	Hash            string `mapstructure:"Hash"`            // hex encoded SHA-256 of the key
+	RequestsPerHour int    `mapstructure:"RequestsPerHour"` // Github requests allowed per hour, 0 for the default one
+	Admin           bool   `mapstructure:"Admin"`           // allowed to manage API keys
+	Lane            string `mapstructure:"Lane"`            // priority lane of the requests made with the key, empty to let the client choose it
+}
+
+type LanesConfig struct {
+	Enabled       bool         `mapstructure:"Enabled"`       // split the Github budget between priority lanes
+	Default       string       `mapstructure:"Default"`       // lane of requests without lane
+	Background    string       `mapstructure:"Background"`    // lane of background jobs, saved searches and events polling
+	LenderReserve int          `mapstructure:"LenderReserve"` // percent of the share of a lane never lent to other lanes
+	Lanes         []LaneConfig `mapstructure:"Lanes"`
+}
+
+type LaneConfig struct {
+	Name  string `mapstructure:"Name"`
+	Share int    `mapstructure:"Share"` // percent of the Github budget guaranteed to the lane
 }
 
 type LogsConfig struct {
@@ -33,51 +153,159 @@ type LogsConfig struct {
 	OutputLogsAsJSON bool   `mapstructure:"OutputLogsAsJSON"`
 }
 
-// Load will open and parse config.toml content to Config struct instance
-func Load() (*Config, error) {
-	dir, err := filepath.Abs(filepath.Dir(os.Args[0]))
-
+// Load builds the config from, by order of precedence: the flags, the environment variables (SCLNG_<SECTION>_<KEY>),
+// the config file and the default values. The config file is the one of the --config flag, otherwise config/config.toml
+// next to the binary or in the working directory.
+// ErrConfigNotFound is returned with the config if there is no config file and no environment variable is set
+func Load(flags Flags) (*Config, error) {
+	configFilePath, err := findConfigFile(flags.ConfigFile)
 	if err != nil {
 		return nil, err
 	}
 
-	// check config file exists
-	configFilePath := dir + "/config/config.toml"
+	// load default and config file content
+	cfg := GetDefault()
 
-	if _, err := os.Stat(dir + "/config/config.toml"); errors.Is(err, os.ErrNotExist) {
-		if _, err := os.Stat("config/config.toml"); errors.Is(err, os.ErrNotExist) {
-			return nil, err
-		} else {
-			configFilePath = "config/config.toml"
+	if configFilePath != "" {
+		if _, err := snakelet.InitAndLoad(cfg, configFilePath); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", configFilePath, err)
 		}
 	}
 
-	// load default and config file content
-	cfg := GetDefault()
-	_, err = snakelet.InitAndLoad(cfg, configFilePath)
-
+	envSet, err := applyEnv(cfg, os.LookupEnv)
 	if err != nil {
 		return nil, err
 	}
 
+	flags.apply(cfg)
+
+	if err := loadTokenFile(cfg); err != nil {
+		return nil, err
+	}
+
+	if configFilePath == "" && !envSet {
+		return cfg, ErrConfigNotFound
+	}
+
 	return cfg, nil
 }
 
+// findConfigFile returns the path of the config file, empty if none is found.
+// A file set with the --config flag must exist
+func findConfigFile(path string) (string, error) {
+	if path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("config file %s: %w", path, err)
+		}
+
+		return path, nil
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(os.Args[0]))
+	if err != nil {
+		return "", err
+	}
+
+	for _, path := range []string{dir + "/config/config.toml", "config/config.toml"} {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", nil
+}
+
 // GetDefault will convert a string to a valid Logrus level
 func GetDefault() *Config {
 	return &Config{
 		API: APIConfig{
-			ListenPort: "5000",
+			ListenPort:     "5000",
+			RequestTimeout: 30,
 		},
 		Github: GithubConfig{
-			Token: "",
+			Token:              "",
+			TokenFile:          "",
+			Source:             GithubSourceSearch,
+			EventsPollInterval: 60,
+			WebhookSecret:      "",
+			RequestTimeout:     10,
+			MaxAttempts:        3,
+			InitialBackoff:     500,
+			MaxBackoff:         10000,
 		},
 		Tasks: TasksConfig{
 			MaxParallelTasksAllowed: 20,
+			MinParallelTasksAllowed: 1,
+			InitialParallelTasks:    8,
+			TargetLatency:           1000,
 		},
 		Logs: LogsConfig{
 			Level:            "debug",
 			OutputLogsAsJSON: false,
 		},
+		Storage: StorageConfig{
+			Enabled:       true,
+			Path:          "data/storage.db",
+			RetentionDays: 30,
+		},
+		Searches: SearchesConfig{
+			RunInterval: 300,
+		},
+		Notifications: NotificationsConfig{
+			WebhookURL:     "",
+			WebhookSecret:  "",
+			MaxAttempts:    5,
+			InitialBackoff: 1000,
+			DeadLetterPath: "data/dead-letters.log",
+		},
+		Breaker: BreakerConfig{
+			Enabled:           true,
+			WindowSize:        20,
+			MinimumCalls:      10,
+			FailureRate:       50,
+			SlowCallThreshold: 5000,
+			OpenDuration:      30,
+		},
+		Cache: CacheConfig{
+			MaxAge:     3600,
+			MaxEntries: 1000,
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+		},
+		Tracing: TracingConfig{
+			Exporter:     "none",
+			FilePath:     "data/traces.json",
+			OTLPEndpoint: "localhost:4318",
+			OTLPInsecure: true,
+			SampleRatio:  1,
+		},
+		Health: HealthConfig{
+			GithubCheckInterval: 15,
+		},
+		Quota: QuotaConfig{
+			CoreLowWaterMark:   10,
+			SearchLowWaterMark: 0,
+		},
+		Auth: AuthConfig{
+			Enabled:                false,
+			DefaultRequestsPerHour: 500,
+			Keys:                   []APIKeyConfig{},
+			JWKSFile:               "",
+			JWKSURL:                "",
+			JWKSRefreshInterval:    3600,
+			JWTIssuer:              "",
+			JWTAudience:            "",
+		},
+		Lanes: LanesConfig{
+			Enabled:       false,
+			Default:       "interactive",
+			Background:    "batch",
+			LenderReserve: 20,
+			Lanes: []LaneConfig{
+				{Name: "interactive", Share: 70},
+				{Name: "batch", Share: 30},
+			},
+		},
 	}
 }
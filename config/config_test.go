@@ -0,0 +1,117 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLoad checks the precedence of the values: flags, then environment variables, then the config file, then the default values
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	configFile := filepath.Join(dir, "config.toml")
+	assert.NoError(t, os.WriteFile(configFile, []byte("[API]\nListenPort = \"6000\"\n[GITHUB]\nToken = \"file-token\"\n[LOGS]\nLevel = \"warn\"\n"), 0o600))
+
+	tokenFile := filepath.Join(dir, "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("secret-token\n"), 0o600))
+
+	tests := []struct {
+		name               string
+		flags              Flags
+		env                map[string]string
+		expectedListenPort string
+		expectedToken      string
+		expectedLevel      string
+		expectedTimeout    int
+		expectedError      string
+	}{
+		{
+			name:               "config file",
+			flags:              Flags{ConfigFile: configFile},
+			expectedListenPort: "6000",
+			expectedToken:      "file-token",
+			expectedLevel:      "warn",
+			expectedTimeout:    30,
+		},
+		{
+			name:               "environment over config file",
+			flags:              Flags{ConfigFile: configFile},
+			env:                map[string]string{"SCLNG_API_LISTENPORT": "7000", "SCLNG_GITHUB_TOKEN": "env-token", "SCLNG_API_REQUESTTIMEOUT": "5"},
+			expectedListenPort: "7000",
+			expectedToken:      "env-token",
+			expectedLevel:      "warn",
+			expectedTimeout:    5,
+		},
+		{
+			name:               "flags over environment",
+			flags:              Flags{ConfigFile: configFile, ListenPort: "8000", LogLevel: "info"},
+			env:                map[string]string{"SCLNG_API_LISTENPORT": "7000", "SCLNG_LOGS_LEVEL": "error"},
+			expectedListenPort: "8000",
+			expectedToken:      "file-token",
+			expectedLevel:      "info",
+			expectedTimeout:    30,
+		},
+		{
+			name:               "token file over token",
+			flags:              Flags{ConfigFile: configFile, GithubTokenFile: tokenFile},
+			env:                map[string]string{"SCLNG_GITHUB_TOKEN": "env-token"},
+			expectedListenPort: "6000",
+			expectedToken:      "secret-token",
+			expectedLevel:      "warn",
+			expectedTimeout:    30,
+		},
+		{
+			name:               "environment without config file",
+			env:                map[string]string{"SCLNG_GITHUB_TOKENFILE": tokenFile},
+			expectedListenPort: "5000",
+			expectedToken:      "secret-token",
+			expectedLevel:      "debug",
+			expectedTimeout:    30,
+		},
+		{
+			name:          "invalid environment variable",
+			flags:         Flags{ConfigFile: configFile},
+			env:           map[string]string{"SCLNG_API_REQUESTTIMEOUT": "soon"},
+			expectedError: `invalid value for SCLNG_API_REQUESTTIMEOUT: strconv.Atoi: parsing "soon": invalid syntax`,
+		},
+		{
+			name:          "config file not found",
+			flags:         Flags{ConfigFile: filepath.Join(dir, "missing.toml")},
+			expectedError: "config file " + filepath.Join(dir, "missing.toml") + ": stat " + filepath.Join(dir, "missing.toml") + ": no such file or directory",
+		},
+		{
+			name:          "token file not found",
+			flags:         Flags{ConfigFile: configFile, GithubTokenFile: filepath.Join(dir, "missing")},
+			expectedError: "unable to read the Github token: open " + filepath.Join(dir, "missing") + ": no such file or directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := Load(tt.flags)
+
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedListenPort, cfg.API.ListenPort)
+			assert.Equal(t, tt.expectedToken, cfg.Github.Token)
+			assert.Equal(t, tt.expectedLevel, cfg.Logs.Level)
+			assert.Equal(t, tt.expectedTimeout, cfg.API.RequestTimeout)
+		})
+	}
+
+	// without config file nor environment variables, the default values are returned with ErrConfigNotFound
+	cfg, err := Load(Flags{})
+	assert.ErrorIs(t, err, ErrConfigNotFound)
+	assert.Equal(t, GetDefault(), cfg)
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Prefix of the environment variables overriding the values of the config file: SCLNG_<SECTION>_<KEY>, e.g. SCLNG_GITHUB_TOKEN
+const EnvPrefix = "SCLNG_"
+
+// Flags are the values set on the command line, they take precedence over the environment and the config file.
+// The Github token can't be set on the command line, where it would be visible to all users of the host, only its file
+type Flags struct {
+	ConfigFile      string
+	ListenPort      string
+	LogLevel        string
+	GithubTokenFile string
+}
+
+// ParseFlags reads the flags of the command line, args without the name of the program
+func ParseFlags(name string, args []string) (Flags, error) {
+	flags := Flags{}
+
+	set := flag.NewFlagSet(name, flag.ContinueOnError)
+	set.StringVar(&flags.ConfigFile, "config", "", "path of the config file, config/config.toml next to the binary or in the working directory by default")
+	set.StringVar(&flags.ListenPort, "listen-port", "", "port of the API, overrides API.ListenPort")
+	set.StringVar(&flags.LogLevel, "log-level", "", "error | warn | info | debug, overrides LOGS.Level")
+	set.StringVar(&flags.GithubTokenFile, "github-token-file", "", "file containing the Github token, overrides GITHUB.TokenFile")
+
+	if err := set.Parse(args); err != nil {
+		return Flags{}, err
+	}
+
+	// errors are printed with the usage, like the ones of the flags
+	if set.NArg() > 0 {
+		err := fmt.Errorf("unexpected argument %q", set.Arg(0))
+		fmt.Fprintln(set.Output(), err)
+		set.Usage()
+
+		return Flags{}, err
+	}
+
+	return flags, nil
+}
+
+func (f Flags) apply(cfg *Config) {
+	if f.ListenPort != "" {
+		cfg.API.ListenPort = f.ListenPort
+	}
+
+	if f.LogLevel != "" {
+		cfg.Logs.Level = f.LogLevel
+	}
+
+	if f.GithubTokenFile != "" {
+		cfg.Github.TokenFile = f.GithubTokenFile
+	}
+}
+
+// applyEnv overrides each value of the config with its environment variable, if set.
+// Only strings, numbers and booleans can be set, lists (API keys, lanes) are only read from the config file.
+// Returns true if at least one variable is set
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) (bool, error) {
+	found := false
+	sections := reflect.ValueOf(cfg).Elem()
+
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		sectionName := sections.Type().Field(i).Tag.Get("mapstructure")
+
+		for j := 0; j < section.NumField(); j++ {
+			field := section.Field(j)
+			name := EnvPrefix + strings.ToUpper(sectionName+"_"+section.Type().Field(j).Tag.Get("mapstructure"))
+
+			value, set := lookup(name)
+			if !set {
+				continue
+			}
+
+			if err := setValue(field, value); err != nil {
+				return found, fmt.Errorf("invalid value for %s: %w", name, err)
+			}
+
+			found = true
+		}
+	}
+
+	return found, nil
+}
+
+func setValue(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+
+	case reflect.Int:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(int64(i))
+
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+
+		field.SetFloat(f)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetBool(b)
+
+	default:
+		return fmt.Errorf("%s values can only be set in the config file", field.Kind())
+	}
+
+	return nil
+}
+
+// loadTokenFile reads the Github token from its file, mounted secrets often end with a new line
+func loadTokenFile(cfg *Config) error {
+	if cfg.Github.TokenFile == "" {
+		return nil
+	}
+
+	token, err := os.ReadFile(cfg.Github.TokenFile)
+	if err != nil {
+		return fmt.Errorf("unable to read the Github token: %w", err)
+	}
+
+	cfg.Github.Token = strings.TrimSpace(string(token))
+
+	return nil
+}
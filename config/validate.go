@@ -0,0 +1,194 @@
+package config
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Log levels accepted in LOGS.Level, case insensitive
+var LogLevels = []string{"error", "warn", "info", "debug"}
+
+// Exporters accepted in TRACING.Exporter
+var tracingExporters = []string{"none", "stdout", "file", "otlp"}
+
+// ValidationError lists all the problems found in a config, so they can be fixed at once
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	report := fmt.Sprintf("invalid configuration, %d problem(s) found:", len(e.Problems))
+
+	for _, problem := range e.Problems {
+		report += "\n  - " + problem
+	}
+
+	return report
+}
+
+// validator collects the problems of a config, each one prefixed with the key in the config file
+type validator struct {
+	problems []string
+}
+
+func (v *validator) check(valid bool, key string, format string, args ...interface{}) {
+	if !valid {
+		v.problems = append(v.problems, key+": "+fmt.Sprintf(format, args...))
+	}
+}
+
+func (v *validator) positive(key string, value int) {
+	v.check(value > 0, key, "must be greater than 0, got %d", value)
+}
+
+func (v *validator) notNegative(key string, value int) {
+	v.check(value >= 0, key, "must be 0 or greater, got %d", value)
+}
+
+func (v *validator) oneOf(key string, value string, allowed []string) {
+	v.check(slices.Contains(allowed, value), key, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+func (v *validator) url(key string, value string) {
+	u, err := url.Parse(value)
+	v.check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", key, "must be an http or https URL, got %q", value)
+}
+
+// Validate checks the values of the config, and returns a ValidationError with all the problems found
+func (c Config) Validate() error {
+	v := &validator{}
+
+	port, err := strconv.Atoi(c.API.ListenPort)
+	v.check(err == nil && port > 0 && port <= 65535, "API.ListenPort", "must be a port number between 1 and 65535, got %q", c.API.ListenPort)
+	v.notNegative("API.RequestTimeout", c.API.RequestTimeout)
+
+	v.oneOf("GITHUB.Source", c.Github.Source, []string{GithubSourceSearch, GithubSourceEvents})
+	v.positive("GITHUB.EventsPollInterval", c.Github.EventsPollInterval)
+	v.notNegative("GITHUB.RequestTimeout", c.Github.RequestTimeout)
+	v.positive("GITHUB.MaxAttempts", c.Github.MaxAttempts)
+	v.notNegative("GITHUB.InitialBackoff", c.Github.InitialBackoff)
+	v.check(c.Github.MaxBackoff >= c.Github.InitialBackoff, "GITHUB.MaxBackoff", "must be greater than or equal to GITHUB.InitialBackoff (%d), got %d", c.Github.InitialBackoff, c.Github.MaxBackoff)
+
+	v.positive("TASKS.MaxParallelTasksAllowed", c.Tasks.MaxParallelTasksAllowed)
+	v.positive("TASKS.MinParallelTasksAllowed", c.Tasks.MinParallelTasksAllowed)
+	v.check(c.Tasks.MinParallelTasksAllowed <= c.Tasks.MaxParallelTasksAllowed, "TASKS.MinParallelTasksAllowed", "must be lower than or equal to TASKS.MaxParallelTasksAllowed (%d), got %d", c.Tasks.MaxParallelTasksAllowed, c.Tasks.MinParallelTasksAllowed)
+	v.check(c.Tasks.InitialParallelTasks >= c.Tasks.MinParallelTasksAllowed && c.Tasks.InitialParallelTasks <= c.Tasks.MaxParallelTasksAllowed, "TASKS.InitialParallelTasks", "must be between TASKS.MinParallelTasksAllowed (%d) and TASKS.MaxParallelTasksAllowed (%d), got %d", c.Tasks.MinParallelTasksAllowed, c.Tasks.MaxParallelTasksAllowed, c.Tasks.InitialParallelTasks)
+	v.positive("TASKS.TargetLatency", c.Tasks.TargetLatency)
+
+	v.check(slices.Contains(LogLevels, strings.ToLower(c.Logs.Level)), "LOGS.Level", "must be one of %s (case insensitive), got %q", strings.Join(LogLevels, ", "), c.Logs.Level)
+
+	if c.Storage.Enabled {
+		v.check(c.Storage.Path != "", "STORAGE.Path", "must be set when the storage is enabled")
+	}
+
+	v.notNegative("STORAGE.RetentionDays", c.Storage.RetentionDays)
+	v.positive("SEARCHES.RunInterval", c.Searches.RunInterval)
+
+	if c.Notifications.WebhookURL != "" {
+		v.url("NOTIFICATIONS.WebhookURL", c.Notifications.WebhookURL)
+		v.check(c.Notifications.WebhookSecret != "", "NOTIFICATIONS.WebhookSecret", "must be set to sign the notifications sent to NOTIFICATIONS.WebhookURL")
+	}
+
+	v.positive("NOTIFICATIONS.MaxAttempts", c.Notifications.MaxAttempts)
+	v.notNegative("NOTIFICATIONS.InitialBackoff", c.Notifications.InitialBackoff)
+
+	if c.Breaker.Enabled {
+		v.positive("CIRCUIT_BREAKER.WindowSize", c.Breaker.WindowSize)
+		v.check(c.Breaker.MinimumCalls > 0 && c.Breaker.MinimumCalls <= c.Breaker.WindowSize, "CIRCUIT_BREAKER.MinimumCalls", "must be between 1 and CIRCUIT_BREAKER.WindowSize (%d), got %d", c.Breaker.WindowSize, c.Breaker.MinimumCalls)
+		v.check(c.Breaker.FailureRate > 0 && c.Breaker.FailureRate <= 100, "CIRCUIT_BREAKER.FailureRate", "must be a percentage between 1 and 100, got %d", c.Breaker.FailureRate)
+		v.positive("CIRCUIT_BREAKER.SlowCallThreshold", c.Breaker.SlowCallThreshold)
+		v.positive("CIRCUIT_BREAKER.OpenDuration", c.Breaker.OpenDuration)
+	}
+
+	v.notNegative("CACHE.MaxAge", c.Cache.MaxAge)
+	v.positive("CACHE.MaxEntries", c.Cache.MaxEntries)
+
+	v.oneOf("TRACING.Exporter", c.Tracing.Exporter, tracingExporters)
+	v.check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "TRACING.SampleRatio", "must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+
+	v.notNegative("HEALTH.GithubCheckInterval", c.Health.GithubCheckInterval)
+	v.check(c.Quota.CoreLowWaterMark >= 0 && c.Quota.CoreLowWaterMark < 100, "QUOTA.CoreLowWaterMark", "must be a percentage of the core limit between 0 and 99, got %d", c.Quota.CoreLowWaterMark)
+	v.check(c.Quota.SearchLowWaterMark >= 0 && c.Quota.SearchLowWaterMark < 100, "QUOTA.SearchLowWaterMark", "must be a percentage of the search limit between 0 and 99, got %d", c.Quota.SearchLowWaterMark)
+
+	c.validateAuth(v)
+	c.validateLanes(v)
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+
+	return nil
+}
+
+func (c Config) validateAuth(v *validator) {
+	v.positive("AUTH.DefaultRequestsPerHour", c.Auth.DefaultRequestsPerHour)
+
+	names := map[string]bool{}
+
+	for i, key := range c.Auth.Keys {
+		prefix := fmt.Sprintf("AUTH.Keys[%d]", i)
+
+		v.check(key.Name != "", prefix+".Name", "must be set")
+		v.check(!names[key.Name], prefix+".Name", "%q is already used by another key", key.Name)
+		names[key.Name] = true
+
+		hash, err := hex.DecodeString(strings.TrimSpace(key.Hash))
+		v.check(err == nil && len(hash) == 32, prefix+".Hash", "must be the hex encoded SHA-256 of the key (64 characters)")
+
+		v.notNegative(prefix+".RequestsPerHour", key.RequestsPerHour)
+
+		if key.Lane != "" {
+			v.check(c.Lanes.HasLane(key.Lane), prefix+".Lane", "lane %q is not declared in LANES.Lanes", key.Lane)
+		}
+	}
+
+	if c.Auth.JWKSFile != "" || c.Auth.JWKSURL != "" {
+		v.check(c.Auth.JWTIssuer != "", "AUTH.JWTIssuer", "must be set to verify bearer tokens")
+		v.check(c.Auth.JWTAudience != "", "AUTH.JWTAudience", "must be set to verify bearer tokens")
+	}
+
+	if c.Auth.JWKSFile == "" && c.Auth.JWKSURL != "" {
+		v.url("AUTH.JWKSURL", c.Auth.JWKSURL)
+	}
+
+	v.notNegative("AUTH.JWKSRefreshInterval", c.Auth.JWKSRefreshInterval)
+}
+
+func (c Config) validateLanes(v *validator) {
+	if !c.Lanes.Enabled {
+		return
+	}
+
+	v.check(len(c.Lanes.Lanes) > 0, "LANES.Lanes", "at least one lane must be declared when lanes are enabled")
+
+	names := map[string]bool{}
+	total := 0
+
+	for i, lane := range c.Lanes.Lanes {
+		prefix := fmt.Sprintf("LANES.Lanes[%d]", i)
+
+		v.check(lane.Name != "", prefix+".Name", "must be set")
+		v.check(!names[lane.Name], prefix+".Name", "%q is already used by another lane", lane.Name)
+		v.check(lane.Share > 0 && lane.Share <= 100, prefix+".Share", "must be a percentage between 1 and 100, got %d", lane.Share)
+
+		names[lane.Name] = true
+		total += lane.Share
+	}
+
+	if len(c.Lanes.Lanes) > 0 {
+		v.check(total == 100, "LANES.Lanes", "shares must add up to 100, got %d", total)
+	}
+
+	v.check(c.Lanes.HasLane(c.Lanes.Default), "LANES.Default", "lane %q is not declared in LANES.Lanes", c.Lanes.Default)
+	v.check(c.Lanes.HasLane(c.Lanes.Background), "LANES.Background", "lane %q is not declared in LANES.Lanes", c.Lanes.Background)
+	v.check(c.Lanes.LenderReserve >= 0 && c.Lanes.LenderReserve <= 100, "LANES.LenderReserve", "must be a percentage between 0 and 100, got %d", c.Lanes.LenderReserve)
+}
+
+// HasLane returns true if the lane is declared
+func (c LanesConfig) HasLane(name string) bool {
+	return slices.ContainsFunc(c.Lanes, func(lane LaneConfig) bool { return lane.Name == name })
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestValidate checks that all the problems of a config are reported at once
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name             string
+		update           func(cfg *Config)
+		expectedProblems []string
+	}{
+		{
+			name:   "default values",
+			update: func(cfg *Config) {},
+		},
+		{
+			name:   "case insensitive log level",
+			update: func(cfg *Config) { cfg.Logs.Level = "INFO" },
+		},
+		{
+			name: "several problems",
+			update: func(cfg *Config) {
+				cfg.API.ListenPort = "http"
+				cfg.Tasks.MaxParallelTasksAllowed = -1
+				cfg.Tasks.MinParallelTasksAllowed = -1
+				cfg.Tasks.InitialParallelTasks = -1
+				cfg.Logs.Level = "verbose"
+			},
+			expectedProblems: []string{
+				`API.ListenPort: must be a port number between 1 and 65535, got "http"`,
+				"TASKS.MaxParallelTasksAllowed: must be greater than 0, got -1",
+				"TASKS.MinParallelTasksAllowed: must be greater than 0, got -1",
+				`LOGS.Level: must be one of error, warn, info, debug (case insensitive), got "verbose"`,
+			},
+		},
+		{
+			name: "source and urls",
+			update: func(cfg *Config) {
+				cfg.Github.Source = "Search"
+				cfg.Notifications.WebhookURL = "hooks.example.com/sclng"
+				cfg.Tracing.SampleRatio = 2
+			},
+			expectedProblems: []string{
+				`GITHUB.Source: must be one of search, events, got "Search"`,
+				`NOTIFICATIONS.WebhookURL: must be an http or https URL, got "hooks.example.com/sclng"`,
+				"NOTIFICATIONS.WebhookSecret: must be set to sign the notifications sent to NOTIFICATIONS.WebhookURL",
+				"TRACING.SampleRatio: must be between 0 and 1, got 2",
+			},
+		},
+		{
+			name: "authentication",
+			update: func(cfg *Config) {
+				cfg.Auth.Keys = []APIKeyConfig{
+					{Name: "ci", Hash: "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"},
+					{Name: "ci", Hash: "not-a-hash", Lane: "realtime"},
+				}
+				cfg.Auth.JWKSURL = "https://auth.example.com/.well-known/jwks.json"
+			},
+			expectedProblems: []string{
+				`AUTH.Keys[1].Name: "ci" is already used by another key`,
+				"AUTH.Keys[1].Hash: must be the hex encoded SHA-256 of the key (64 characters)",
+				`AUTH.Keys[1].Lane: lane "realtime" is not declared in LANES.Lanes`,
+				"AUTH.JWTIssuer: must be set to verify bearer tokens",
+				"AUTH.JWTAudience: must be set to verify bearer tokens",
+			},
+		},
+		{
+			name: "quota low-water marks",
+			update: func(cfg *Config) {
+				cfg.Quota.CoreLowWaterMark = 500
+				cfg.Quota.SearchLowWaterMark = -1
+			},
+			expectedProblems: []string{
+				"QUOTA.CoreLowWaterMark: must be a percentage of the core limit between 0 and 99, got 500",
+				"QUOTA.SearchLowWaterMark: must be a percentage of the search limit between 0 and 99, got -1",
+			},
+		},
+		{
+			name: "lanes",
+			update: func(cfg *Config) {
+				cfg.Lanes.Enabled = true
+				cfg.Lanes.Default = "realtime"
+				cfg.Lanes.Background = "bulk"
+				cfg.Lanes.Lanes = []LaneConfig{{Name: "interactive", Share: 70}, {Name: "batch", Share: 40}}
+			},
+			expectedProblems: []string{
+				"LANES.Lanes: shares must add up to 100, got 110",
+				`LANES.Default: lane "realtime" is not declared in LANES.Lanes`,
+				`LANES.Background: lane "bulk" is not declared in LANES.Lanes`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := GetDefault()
+			tt.update(cfg)
+
+			err := cfg.Validate()
+
+			if len(tt.expectedProblems) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			var validationErr *ValidationError
+			assert.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, tt.expectedProblems, validationErr.Problems)
+		})
+	}
+}
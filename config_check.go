@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+)
+
+// checkConfig prints the problems of the configuration loaded, and returns the exit code of the config check command
+func checkConfig(cfg *config.Config, loadErr error) int {
+	if errors.Is(loadErr, config.ErrConfigNotFound) {
+		fmt.Fprintln(os.Stderr, "warning: "+loadErr.Error()+", default values are checked")
+	} else if loadErr != nil {
+		fmt.Fprintln(os.Stderr, loadErr)
+		return 1
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Println("configuration is valid")
+
+	return 0
+}
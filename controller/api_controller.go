@@ -1,18 +1,32 @@
 package controller
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/metrics"
 	"github.com/Scalingo/sclng-backend-test-v1/model"
 	"github.com/Scalingo/sclng-backend-test-v1/service"
+	"github.com/Scalingo/sclng-backend-test-v1/tracing"
 	"github.com/gin-gonic/gin"
 )
 
+// Content types available with the Accept header to stream repositories
+const (
+	ndjsonContentType = "application/x-ndjson"
+	sseContentType    = "text/event-stream"
+)
+
 type APIController interface {
 	PingHandler(c *gin.Context)
 	GetRepositories(ctx *gin.Context)
+	GetRepositoryHistory(ctx *gin.Context)
 }
 
 type apiController struct {
@@ -28,27 +42,173 @@ func NewAPIController(config config.Config, service service.GithubService) APICo
 }
 
 func (s apiController) PingHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "pong"})
+	c.JSON(http.StatusOK, gin.H{
+		"status":               "pong",
+		"circuitBreaker":       s.githubService.CircuitBreakerState(),
+		"languagesConcurrency": s.githubService.ConcurrencyLevel(),
+	})
 }
 
 func (s apiController) GetRepositories(c *gin.Context) {
 	var searchQuery model.SearchQuery
 	if err := c.ShouldBindQuery(&searchQuery); err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+		AbortWithProblem(c, model.ErrInvalidQuery.Wrap(err))
 		return
 	}
 
-	// execute the request
-	repos, err := s.githubService.FetchLastHundredRepositories(c, searchQuery)
-	if err != nil {
-		if strings.Contains(err.Error(), "RATE_LIMIT_REACHED") {
-			c.JSON(http.StatusTooManyRequests, model.NewAPIError(err))
+	// the request context is cancelled when the client disconnects,
+	// so requests to Github are stopped as soon as the response is not expected anymore
+	ctx, cancel := s.requestContext(c)
+	defer cancel()
+
+	ctx, span := tracing.Start(ctx, "GetRepositories", tracing.QueryAttributes(searchQuery)...)
+	defer span.End()
+
+	// dry run, only the search is executed to estimate the cost of the query
+	if c.Query("dryRun") == "true" {
+		estimate, err := s.githubService.EstimateLastHundredRepositories(ctx, searchQuery)
+		if err != nil {
+			AbortWithProblem(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, estimate)
+		return
+	}
+
+	// Github quota low, the remaining requests are kept until the reset and only cached results are served.
+	// With the events source, repositories are already served without calling Github
+	if low, reset := s.githubService.QuotaLow(); low && s.config.Github.Source == config.GithubSourceSearch {
+		s.serveCacheOnly(c, searchQuery, reset)
+		return
+	}
+
+	// streaming mode, repositories are sent as soon as their languages are loaded
+	accept := c.GetHeader("Accept")
+	if strings.Contains(accept, ndjsonContentType) || strings.Contains(accept, sseContentType) {
+		s.streamRepositories(ctx, c, searchQuery, strings.Contains(accept, sseContentType))
+		return
+	}
+
+	// partial mode, languages are loaded for as many repositories as the rate limit allows
+	if c.Query("partial") == "true" {
+		result, err := s.githubService.FetchLastHundredRepositoriesPartial(ctx, searchQuery)
+		if err != nil {
+			AbortWithProblem(c, err)
 			return
 		}
 
-		c.JSON(http.StatusInternalServerError, model.NewAPIError(err))
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	// execute the request, sharing the execution with concurrent identical requests
+	repos, coalesced, err := s.githubService.CoalesceLastHundredRepositories(ctx, searchQuery)
+	c.Header("X-Coalesced", strconv.FormatBool(coalesced))
+
+	// Github unavailable, the last results of the same search are served if recent enough
+	if errors.Is(err, model.ErrUpstreamUnavailable) {
+		if cached, fetchedAt, found := s.cachedRepositories(searchQuery); found {
+			c.Header("X-Cache", "STALE")
+			c.Header("Age", strconv.Itoa(int(time.Since(fetchedAt).Seconds())))
+			c.JSON(http.StatusOK, cached)
+			return
+		}
+	}
+
+	if err != nil {
+		AbortWithProblem(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, repos)
 }
+
+// serveCacheOnly serves the last results of the search if they are cached, without calling Github
+func (s apiController) serveCacheOnly(c *gin.Context, searchQuery model.SearchQuery, reset time.Time) {
+	cached, fetchedAt, found := s.cachedRepositories(searchQuery)
+	if !found {
+		AbortWithProblem(c, model.ErrQuotaLow.WithRetryAfter(time.Until(reset)))
+		return
+	}
+
+	c.Header("X-Cache", "HIT")
+	c.Header("Age", strconv.Itoa(int(time.Since(fetchedAt).Seconds())))
+	c.JSON(http.StatusOK, cached)
+}
+
+// cachedRepositories looks for the last results of the search to serve them instead of calling Github,
+// each lookup is counted in the metrics
+func (s apiController) cachedRepositories(searchQuery model.SearchQuery) ([]model.GithubRepository, time.Time, bool) {
+	cached, fetchedAt, found := s.githubService.CachedRepositories(searchQuery)
+
+	if found {
+		metrics.CacheRequests.WithLabelValues("hit").Inc()
+	} else {
+		metrics.CacheRequests.WithLabelValues("miss").Inc()
+	}
+
+	return cached, fetchedAt, found
+}
+
+// streamRepositories writes each repository as a line of JSON (NDJSON) or as a Server-Sent Event.
+// Headers are written with the first event, so errors occurring before can still be returned with the right status
+func (s apiController) streamRepositories(ctx context.Context, c *gin.Context, searchQuery model.SearchQuery, useSSE bool) {
+	started := false
+
+	err := s.githubService.StreamLastHundredRepositories(ctx, searchQuery, func(event model.StreamEvent) {
+		if !started {
+			started = true
+			c.Header("Cache-Control", "no-cache")
+			c.Header("X-Accel-Buffering", "no")
+
+			if useSSE {
+				c.Header("Content-Type", sseContentType)
+			} else {
+				c.Header("Content-Type", ndjsonContentType)
+			}
+
+			c.Status(http.StatusOK)
+		}
+
+		if useSSE {
+			if event.Type == model.StreamEventSummary {
+				c.SSEvent(event.Type, event.Summary)
+			} else {
+				c.SSEvent(event.Type, event.Repository)
+			}
+		} else {
+			line, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+
+			_, _ = c.Writer.Write(append(line, '\n'))
+		}
+
+		c.Writer.Flush()
+	})
+
+	if err != nil {
+		AbortWithProblem(c, err)
+	}
+}
+
+// requestContext returns the context of the request, with the configured timeout
+func (s apiController) requestContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	if s.config.API.RequestTimeout <= 0 {
+		return context.WithCancel(c.Request.Context())
+	}
+
+	return context.WithTimeout(c.Request.Context(), time.Duration(s.config.API.RequestTimeout)*time.Second)
+}
+
+func (s apiController) GetRepositoryHistory(c *gin.Context) {
+	history, err := s.githubService.GetRepositoryHistory(c.Param("owner"), c.Param("name"))
+	if err != nil {
+		AbortWithProblem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/service"
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeysController interface {
+	CreateKey(c *gin.Context)
+	ListKeys(c *gin.Context)
+	DeleteKey(c *gin.Context)
+}
+
+type apiKeysController struct {
+	authService service.AuthService
+	config      config.Config
+}
+
+func NewAPIKeysController(config config.Config, service service.AuthService) APIKeysController {
+	return apiKeysController{
+		authService: service,
+		config:      config,
+	}
+}
+
+func (s apiKeysController) CreateKey(c *gin.Context) {
+	var key model.APIKey
+	if err := c.ShouldBindJSON(&key); err != nil {
+		AbortWithProblem(c, model.ErrInvalidPayload.Wrap(err))
+		return
+	}
+
+	created, err := s.authService.CreateKey(key)
+	if err != nil {
+		AbortWithProblem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+func (s apiKeysController) ListKeys(c *gin.Context) {
+	keys, err := s.authService.ListKeys()
+	if err != nil {
+		AbortWithProblem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+func (s apiKeysController) DeleteKey(c *gin.Context) {
+	if err := s.authService.DeleteKey(c.Param("name")); err != nil {
+		AbortWithProblem(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/Scalingo/sclng-backend-test-v1/logger"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AbortWithProblem writes the error as an application/problem+json body (RFC 7807),
+// with the HTTP status declared for its code and the Retry-After header when the delay is known.
+// Also used by middlewares rejecting requests
+func AbortWithProblem(c *gin.Context, err error) {
+	problem := model.NewProblem(err, c.Request.URL.Path, logger.RequestIDFromContext(c.Request.Context()))
+
+	// the error is recorded on the span of the request, if traced
+	span := trace.SpanFromContext(c.Request.Context())
+	span.RecordError(err)
+	span.SetAttributes(attribute.String("error.code", problem.Code))
+
+	if problem.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(problem.RetryAfter))
+	}
+
+	// set before rendering, so the JSON renderer keeps this content type
+	c.Header("Content-Type", model.ProblemContentType)
+	c.Render(problem.Status, render.JSON{Data: problem})
+	c.Abort()
+}
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/service"
+	"github.com/gin-gonic/gin"
+)
+
+type HealthController interface {
+	Healthz(c *gin.Context)
+	Readyz(c *gin.Context)
+}
+
+type healthController struct {
+	healthService service.HealthService
+	config        config.Config
+}
+
+func NewHealthController(config config.Config, service service.HealthService) HealthController {
+	return healthController{
+		healthService: service,
+		config:        config,
+	}
+}
+
+// Healthz answers as long as the process is able to handle requests, whatever the state of its dependencies
+func (s healthController) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz answers 503 when /repos can't be served, with the state of each dependency
+func (s healthController) Readyz(c *gin.Context) {
+	readiness := s.healthService.Readiness(c.Request.Context())
+
+	if !readiness.Ready {
+		c.JSON(http.StatusServiceUnavailable, readiness)
+		return
+	}
+
+	c.JSON(http.StatusOK, readiness)
+}
@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/service"
+	"github.com/gin-gonic/gin"
+)
+
+type QuotaController interface {
+	GetRateLimit(c *gin.Context)
+}
+
+type quotaController struct {
+	quotaService service.QuotaService
+	config       config.Config
+}
+
+func NewQuotaController(config config.Config, service service.QuotaService) QuotaController {
+	return quotaController{
+		quotaService: service,
+		config:       config,
+	}
+}
+
+// GetRateLimit returns the view of the service on each Github bucket
+func (s quotaController) GetRateLimit(c *gin.Context) {
+	c.JSON(http.StatusOK, s.quotaService.Status())
+}
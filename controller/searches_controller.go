@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/service"
+	"github.com/gin-gonic/gin"
+)
+
+type SearchesController interface {
+	CreateSearch(c *gin.Context)
+	ListSearches(c *gin.Context)
+	GetSearch(c *gin.Context)
+	UpdateSearch(c *gin.Context)
+	DeleteSearch(c *gin.Context)
+}
+
+type searchesController struct {
+	searchesService service.SearchesService
+	config          config.Config
+}
+
+func NewSearchesController(config config.Config, service service.SearchesService) SearchesController {
+	return searchesController{
+		searchesService: service,
+		config:          config,
+	}
+}
+
+func (s searchesController) CreateSearch(c *gin.Context) {
+	var search model.SavedSearch
+	if err := c.ShouldBindJSON(&search); err != nil {
+		AbortWithProblem(c, model.ErrInvalidPayload.Wrap(err))
+		return
+	}
+
+	search, err := s.searchesService.CreateSearch(search)
+	if err != nil {
+		AbortWithProblem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, search)
+}
+
+func (s searchesController) ListSearches(c *gin.Context) {
+	searches, err := s.searchesService.ListSearches()
+	if err != nil {
+		AbortWithProblem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, searches)
+}
+
+func (s searchesController) GetSearch(c *gin.Context) {
+	search, err := s.searchesService.GetSearch(c.Param("id"))
+	if err != nil {
+		AbortWithProblem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, search)
+}
+
+func (s searchesController) UpdateSearch(c *gin.Context) {
+	var search model.SavedSearch
+	if err := c.ShouldBindJSON(&search); err != nil {
+		AbortWithProblem(c, model.ErrInvalidPayload.Wrap(err))
+		return
+	}
+
+	search, err := s.searchesService.UpdateSearch(c.Param("id"), search)
+	if err != nil {
+		AbortWithProblem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, search)
+}
+
+func (s searchesController) DeleteSearch(c *gin.Context) {
+	if err := s.searchesService.DeleteSearch(c.Param("id")); err != nil {
+		AbortWithProblem(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
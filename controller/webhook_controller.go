@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/service"
+	"github.com/gin-gonic/gin"
+)
+
+// Maximum payload size sent by Github for a webhook
+const maxWebhookPayloadSize = 25 << 20
+
+type WebhookController interface {
+	HandleGithubEvent(c *gin.Context)
+}
+
+type webhookController struct {
+	webhookService service.WebhookService
+	config         config.Config
+}
+
+func NewWebhookController(config config.Config, service service.WebhookService) WebhookController {
+	return webhookController{
+		webhookService: service,
+		config:         config,
+	}
+}
+
+func (s webhookController) HandleGithubEvent(c *gin.Context) {
+	// the raw body is required to check the signature
+	payload, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookPayloadSize))
+	if err != nil {
+		AbortWithProblem(c, model.ErrInvalidPayload.Wrap(err))
+		return
+	}
+
+	if err := s.webhookService.VerifySignature(c.GetHeader("X-Hub-Signature-256"), payload); err != nil {
+		AbortWithProblem(c, err)
+		return
+	}
+
+	status, err := s.webhookService.HandleGithubEvent(c.Request.Context(), c.GetHeader("X-GitHub-Event"), c.GetHeader("X-GitHub-Delivery"), payload)
+	if err != nil {
+		AbortWithProblem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": status})
+}
@@ -18,9 +18,12 @@ func Setup(cfg config.Config) {
 	}
 
 	logrus.SetLevel(StringToLogrusLogType(cfg.Logs.Level))
+	logrus.AddHook(requestIDHook{})
+	logrus.AddHook(principalHook{})
 }
 
-// StringToLogrusLogType will convert string to the right logrus level
+// StringToLogrusLogType will convert string to the right logrus level.
+// Unknown levels are refused by config.Validate, the error level is only a fallback
 func StringToLogrusLogType(logLevel string) logrus.Level {
 	logLevelLowerCase := strings.ToLower(logLevel)
 	switch logLevelLowerCase {
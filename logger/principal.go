@@ -0,0 +1,42 @@
+package logger
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Field added to log entries made during an authenticated request
+const PrincipalField = "principal"
+
+type principalKey struct{}
+
+// ContextWithPrincipal returns a copy of the context holding the ID of the authenticated client
+func ContextWithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the ID of the authenticated client held by the context, empty if none
+func PrincipalFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	principal, _ := ctx.Value(principalKey{}).(string)
+	return principal
+}
+
+// principalHook adds the authenticated client to entries logged with a request context (log.WithContext(ctx))
+type principalHook struct{}
+
+func (principalHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (principalHook) Fire(entry *logrus.Entry) error {
+	if principal := PrincipalFromContext(entry.Context); principal != "" {
+		entry.Data[PrincipalField] = principal
+	}
+
+	return nil
+}
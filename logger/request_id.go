@@ -0,0 +1,43 @@
+package logger
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Field added to log entries made during a request
+const RequestIDField = "requestId"
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of the context holding the request ID
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID held by the context, empty if none
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// requestIDHook adds the request ID to entries logged with a request context (log.WithContext(ctx)),
+// so all logs of a request, including the ones from goroutines, can be correlated
+type requestIDHook struct{}
+
+func (requestIDHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (requestIDHook) Fire(entry *logrus.Entry) error {
+	if requestID := RequestIDFromContext(entry.Context); requestID != "" {
+		entry.Data[RequestIDField] = requestID
+	}
+
+	return nil
+}
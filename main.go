@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,7 +14,12 @@ import (
 	"github.com/Scalingo/sclng-backend-test-v1/config"
 	"github.com/Scalingo/sclng-backend-test-v1/controller"
 	"github.com/Scalingo/sclng-backend-test-v1/logger"
+	"github.com/Scalingo/sclng-backend-test-v1/metrics"
+	"github.com/Scalingo/sclng-backend-test-v1/middleware"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
 	"github.com/Scalingo/sclng-backend-test-v1/service"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	"github.com/Scalingo/sclng-backend-test-v1/tracing"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/google/go-github/v66/github"
@@ -20,14 +28,57 @@ import (
 )
 
 func main() {
-	cfg, err := config.Load()
-	if err != nil {
-		log.WithError(err).Error("unable to load configuration")
+	// "config check" only loads and validates the configuration, with the same flags as the service
+	args := os.Args[1:]
+	check := len(args) >= 2 && args[0] == "config" && args[1] == "check"
+
+	if check {
+		args = args[2:]
+	}
+
+	// the usage is already printed by the flags parser
+	flags, err := config.ParseFlags(os.Args[0], args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		os.Exit(2)
+	}
+
+	// without a configuration file nor environment variables, default values are used and reported by the readiness check.
+	// An invalid file stops the service, running with a partial configuration would hide the problem
+	cfg, configErr := config.Load(flags)
+	if check {
+		os.Exit(checkConfig(cfg, configErr))
+	}
+
+	if errors.Is(configErr, config.ErrConfigNotFound) {
+		log.WithError(configErr).Error("unable to load configuration. default values will be used")
+	} else if configErr != nil {
+		log.WithError(configErr).Error("unable to load configuration. fix the configuration file and restart")
+		os.Exit(1)
+	}
+
+	// all the problems are reported at once, before anything is started
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
 	// configure logger
 	logger.Setup(*cfg)
 
+	// configure tracing, spans not exported yet are flushed when the server stops
+	shutdownTracing, err := tracing.Setup(cfg.Tracing)
+	if err != nil {
+		log.WithError(err).Error("unable to configure tracing. spans will not be exported")
+	}
+
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.WithError(err).Error("unable to flush spans")
+		}
+	}()
+
 	// setup github client
 	// we do here and pass the client to Github service to easily improve tests with mock client
 	githubClient := github.NewClient(nil)
@@ -37,31 +88,70 @@ func main() {
 		githubClient = githubClient.WithAuthToken(cfg.Github.Token)
 	}
 
-	// setup local rate limiter
-	// execute first request to github to fetch current rate limits
-	log.Debug("loading current rate limit from github")
-	rateLimits, _, err := githubClient.RateLimit.Get(context.Background())
-	if err != nil {
-		log.WithError(err).Panic("unable to load current github rate limits")
+	// setup local rate limiter with the default quota of Github.
+	// It's synchronized in background with the current rate limits (see BootstrapRateLimiter),
+	// so the service starts even if Github is unreachable
+	defaultLimit := service.DefaultUnauthenticatedLimit
+	if cfg.Github.Token != "" {
+		defaultLimit = service.DefaultAuthenticatedLimit
 	}
 
-	log.WithFields(log.Fields{
-		"totalAvailable":    rateLimits.Core.Limit,
-		"remainingRequests": rateLimits.Core.Remaining,
-	}).Debug("will setup local rate limiter with rate limits infos from github")
+	rateLimiter := rate.NewLimiter(rate.Every(time.Hour), defaultLimit)
+
+	// setup storage, to keep repositories and languages history between restarts
+	store := storage.NewNoopStorage()
 
-	// setup rate limiter
-	// consume X tokens according to the number of remaining tokens
-	// this help us to have a right rate limiter even if external requests are made
-	rateLimiter := rate.NewLimiter(rate.Every(time.Hour), rateLimits.Core.Limit)
+	if cfg.Storage.Enabled {
+		log.WithField("path", cfg.Storage.Path).Debug("will open storage database")
 
-	if !rateLimiter.AllowN(time.Now(), rateLimits.Core.Limit-rateLimits.Core.Remaining) {
-		log.WithError(err).Panic("unable to configure the github rate limiter")
+		// a database locked by another process or not writable stops the service, like an invalid configuration
+		store, err = storage.NewBoltStorage(cfg.Storage)
+		if err != nil {
+			log.WithError(err).WithField("path", cfg.Storage.Path).Error("unable to open storage database. fix the storage path or disable the storage and restart")
+			os.Exit(1)
+		}
 	}
 
+	defer store.Close()
+
 	// setup handlers and services
-	githubService := service.NewGithubService(*cfg, githubClient, rateLimiter)
+	githubService := service.NewGithubService(*cfg, githubClient, rateLimiter, store)
+	notificationService := service.NewNotificationService(*cfg)
+	searchesService := service.NewSearchesService(*cfg, githubService, notificationService, store)
 	apiController := controller.NewAPIController(*cfg, githubService)
+	searchesController := controller.NewSearchesController(*cfg, searchesService)
+	webhookService := service.NewWebhookService(*cfg, githubService, store)
+	webhookController := controller.NewWebhookController(*cfg, webhookService)
+	healthService := service.NewHealthService(*cfg, githubService, store, configErr)
+	healthController := controller.NewHealthController(*cfg, healthService)
+	quotaService := service.NewQuotaService(*cfg, githubService, notificationService)
+	quotaController := controller.NewQuotaController(*cfg, quotaService)
+	authService := service.NewAuthService(*cfg, store)
+	apiKeysController := controller.NewAPIKeysController(*cfg, authService)
+
+	// background tasks (events polling, storage retention, ...)
+	// the context is cancelled when the server is shutting down
+	backgroundCtx, stopBackgroundTasks := context.WithCancel(context.Background())
+	defer stopBackgroundTasks()
+
+	go githubService.BootstrapRateLimiter(backgroundCtx)
+	go quotaService.RunQuotaAlerts(backgroundCtx)
+	go store.RunRetention(backgroundCtx, time.Hour)
+
+	// jobs calling GitHub run in the background lane, so they can't consume the budget of interactive clients
+	jobsCtx, err := githubService.WithLane(backgroundCtx, cfg.Lanes.Background)
+	if err != nil {
+		log.WithError(err).WithField("lane", cfg.Lanes.Background).Error("unable to use the background lane. declare it in LANES.Lanes and restart")
+		os.Exit(1)
+	}
+
+	if cfg.Storage.Enabled {
+		go searchesService.RunSavedSearches(jobsCtx)
+	}
+
+	if cfg.Github.Source == config.GithubSourceEvents {
+		go githubService.PollRepositoryEvents(jobsCtx)
+	}
 
 	// setup server and define all routes
 	gin.SetMode(gin.ReleaseMode)
@@ -73,18 +163,84 @@ func main() {
 	}
 
 	router.Use(
+		middleware.RequestID(),
+		middleware.Tracing(),
+		middleware.Metrics(),
 		cors.New(cors.Config{
-			AllowOrigins: []string{"*"},
-			AllowMethods: []string{"GET"},
-			AllowHeaders: []string{"Content-Type, Content-Length, Accept-Encoding, Host, accept, Origin, Cache-Control, X-Requested-With"},
-			MaxAge:       12 * time.Hour,
+			AllowOrigins:  []string{"*"},
+			AllowMethods:  []string{"GET", "POST", "PUT", "DELETE"},
+			AllowHeaders:  []string{"Content-Type, Content-Length, Accept-Encoding, Host, accept, Origin, Cache-Control, X-Requested-With, X-Request-ID, X-API-Key, Authorization, X-Priority-Lane"},
+			ExposeHeaders: []string{"X-Request-ID"},
+			MaxAge:        12 * time.Hour,
 		}),
 	)
 
-	api := router.Group("")
+	// probes and the Github webhook (authenticated with its signature) never require an API key or a token
+	public := router.Group("")
+	{
+		public.GET("/ping", apiController.PingHandler)
+		public.GET("/healthz", healthController.Healthz)
+		public.GET("/readyz", healthController.Readyz)
+
+		public.POST("/webhooks/github", webhookController.HandleGithubEvent)
+	}
+
+	// with authentication, each group of routes requires its own scope, API keys have the read scopes and admin keys all of them
+	reposRead := router.Group("")
+	statsRead := router.Group("")
+	searchesWrite := router.Group("")
+
+	if cfg.Auth.Enabled {
+		reposRead.Use(middleware.Authenticate(authService), middleware.RequireScope(model.ScopeReposRead))
+		statsRead.Use(middleware.Authenticate(authService), middleware.RequireScope(model.ScopeStatsRead))
+		searchesWrite.Use(middleware.Authenticate(authService), middleware.RequireScope(model.ScopeSearchesWrite))
+	}
+
+	// the lane is chosen once authenticated, the lane of the API key takes precedence over the header
+	reposRead.Use(middleware.PriorityLane(githubService))
+
 	{
-		api.GET("/ping", apiController.PingHandler)
-		api.GET("/repos", apiController.GetRepositories)
+		statsRead.GET("/ratelimit", quotaController.GetRateLimit)
+
+		reposRead.GET("/repos", apiController.GetRepositories)
+		reposRead.GET("/repos/:owner/:name/history", apiController.GetRepositoryHistory)
+
+		reposRead.GET("/searches", searchesController.ListSearches)
+		reposRead.GET("/searches/:id", searchesController.GetSearch)
+
+		searchesWrite.POST("/searches", searchesController.CreateSearch)
+		searchesWrite.PUT("/searches/:id", searchesController.UpdateSearch)
+		searchesWrite.DELETE("/searches/:id", searchesController.DeleteSearch)
+	}
+
+	// API keys can only be managed with the admin scope, so these routes don't exist without authentication
+	if cfg.Auth.Enabled {
+		admin := router.Group("", middleware.Authenticate(authService), middleware.RequireScope(model.ScopeAdmin))
+		{
+			admin.POST("/apikeys", apiKeysController.CreateKey)
+			admin.GET("/apikeys", apiKeysController.ListKeys)
+			admin.DELETE("/apikeys/:name", apiKeysController.DeleteKey)
+		}
+	}
+
+	if cfg.Metrics.Enabled {
+		metrics.RegisterGauge("github_ratelimiter_tokens", "Requests available in the local Github rate limiter.", func() float64 {
+			return rateLimiter.Tokens()
+		})
+
+		metrics.RegisterGauge("languages_concurrency_level", "Languages requests currently allowed to run concurrently.", func() float64 {
+			return float64(githubService.ConcurrencyLevel())
+		})
+
+		metrics.RegisterGauge("circuit_breaker_open", "1 when the circuit breaker around the Github client is open.", func() float64 {
+			if githubService.CircuitBreakerState() == service.CircuitOpen {
+				return 1
+			}
+
+			return 0
+		})
+
+		router.GET("/metrics", gin.WrapH(metrics.Handler()))
 	}
 
 	// start with configuration
@@ -112,6 +268,7 @@ func main() {
 
 	// Do some actions here : close DB connections, ...
 	log.Info("SIGINT, SIGTERM received, will shut down server ...")
+	stopBackgroundTasks()
 
 	if err := server.Shutdown(ctx); err != nil {
 		log.WithError(err).Error("Server forced to shutdown")
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace of all metrics exposed by the service
+const namespace = "sclng"
+
+// Registry holds all metrics of the service, with the Go runtime and process ones.
+// A dedicated registry is used instead of the global one, to only expose metrics declared here.
+// Labels only take values from fixed sets (routes, status codes, endpoints, outcomes) to keep the cardinality bounded
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequestDuration is the latency of API requests, by route and status
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of API requests, by route and status code.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"method", "route", "status"})
+
+	// GithubCalls counts calls made to Github, by endpoint and outcome
+	GithubCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "github_calls_total",
+		Help:      "Calls made to the Github API, by endpoint and outcome.",
+	}, []string{"endpoint", "outcome"})
+
+	// GithubRateLimitRemaining is the remaining quota of each Github bucket, as reported by the last response
+	GithubRateLimitRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "github_ratelimit_remaining",
+		Help:      "Remaining requests in the Github rate limit, by resource (core, search), from the last response headers.",
+	}, []string{"resource"})
+
+	// LanguagesFanOut is the number of languages requests needed by a search
+	LanguagesFanOut = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "languages_fanout_size",
+		Help:      "Number of repositories whose languages are loaded for a single search.",
+		Buckets:   []float64{0, 10, 25, 50, 75, 100},
+	})
+
+	// LanguagesInFlight is the number of goroutines currently loading languages
+	LanguagesInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "languages_inflight_requests",
+		Help:      "Goroutines currently loading languages of a repository.",
+	})
+
+	// CacheRequests counts lookups in the results cache, by result (hit, miss)
+	CacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Lookups in the cache of search results, by result (hit, miss).",
+	}, []string{"result"})
+
+	// APIKeyRequests counts authenticated requests, by API key name. Keys are declared by admins, so their number stays low.
+	// Requests with a bearer token are all counted under the jwt name
+	APIKeyRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_key_requests_total",
+		Help:      "Authenticated API requests, by API key name (jwt for bearer tokens).",
+	}, []string{"key"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequestDuration,
+		GithubCalls,
+		GithubRateLimitRemaining,
+		LanguagesFanOut,
+		LanguagesInFlight,
+		CacheRequests,
+		APIKeyRequests,
+	)
+}
+
+// RegisterGauge exposes a value read at each scrape, for states owned by other components (rate limiter, concurrency, ...)
+func RegisterGauge(name string, help string, value func() float64) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, value))
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
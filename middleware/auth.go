@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Scalingo/sclng-backend-test-v1/controller"
+	"github.com/Scalingo/sclng-backend-test-v1/logger"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/service"
+	"github.com/gin-gonic/gin"
+)
+
+// Header used to send the API key
+const APIKeyHeader = "X-API-Key"
+
+// Key of the authenticated client (model.Principal) in the gin context
+const PrincipalContextKey = "principal"
+
+// Authenticate authenticates requests with the bearer token sent in the Authorization header, or with the API key sent
+// in the X-API-Key header, and refuses the other ones with 401.
+// The client is added to the logs of the request, and its share of the Github budget is kept in the request context,
+// so requests to Github are also counted in it
+func Authenticate(authService service.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, principal, err := authService.Authenticate(c.Request.Context(), c.GetHeader(APIKeyHeader), bearerToken(c))
+		if err != nil {
+			controller.AbortWithProblem(c, err)
+			return
+		}
+
+		c.Request = c.Request.WithContext(logger.ContextWithPrincipal(ctx, principal.ID()))
+		c.Set(PrincipalContextKey, principal)
+
+		c.Next()
+
+		if c.Writer.Status() == http.StatusTooManyRequests {
+			authService.CountRejected(ctx)
+		}
+	}
+}
+
+// RequireScope refuses with 403 requests whose client doesn't have the scope
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get(PrincipalContextKey)
+
+		if principal, _ := value.(model.Principal); !principal.HasScope(scope) {
+			controller.AbortWithProblem(c, model.ErrForbidden)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// bearerToken returns the token of an Authorization header using the Bearer scheme, empty otherwise
+func bearerToken(c *gin.Context) string {
+	scheme, token, found := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"github.com/Scalingo/sclng-backend-test-v1/controller"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/service"
+	"github.com/gin-gonic/gin"
+)
+
+// Header used by clients to choose their priority lane
+const PriorityLaneHeader = "X-Priority-Lane"
+
+// PriorityLane chooses the lane from which the Github tokens of the request are taken: the lane of the API key if it has one,
+// otherwise the lane sent in the X-Priority-Lane header. Unknown lanes are refused with 400
+func PriorityLane(githubService service.GithubService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lane := c.GetHeader(PriorityLaneHeader)
+
+		value, _ := c.Get(PrincipalContextKey)
+		if principal, _ := value.(model.Principal); principal.Lane != "" {
+			lane = principal.Lane
+		}
+
+		ctx, err := githubService.WithLane(c.Request.Context(), lane)
+		if err != nil {
+			controller.AbortWithProblem(c, err)
+			return
+		}
+
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// Methods used as label, any other method sent by a client is counted as "other"
+var knownMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// Metrics records the latency of each request, by route and status.
+// The route template is used (/repos/:owner/:name/history), not the path, and unknown methods are grouped,
+// to keep the number of series bounded
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		method := c.Request.Method
+		if !slices.Contains(knownMethods, method) {
+			method = "other"
+		}
+
+		metrics.HTTPRequestDuration.
+			WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
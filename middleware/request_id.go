@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/Scalingo/sclng-backend-test-v1/logger"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Header used to receive and return the request ID
+const RequestIDHeader = "X-Request-ID"
+
+// Request IDs sent by clients are only kept if they are reasonably short and safe to log
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID keeps the X-Request-ID sent by the client, or generates a new one.
+// The ID is stored in the request context, so it's added to logs, error bodies and calls to Github,
+// and returned in the X-Request-ID response header
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+
+		c.Request = c.Request.WithContext(logger.ContextWithRequestID(c.Request.Context(), requestID))
+		c.Header(RequestIDHeader, requestID)
+
+		c.Next()
+
+		log.WithContext(c.Request.Context()).WithFields(log.Fields{
+			"method": c.Request.Method,
+			"path":   c.FullPath(),
+			"status": c.Writer.Status(),
+		}).Debug("request handled")
+	}
+}
+
+// newRequestID generates a random ID of 128 bits, hex encoded
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
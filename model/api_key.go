@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// Where an API key is declared
+const (
+	APIKeySourceConfig  = "config"
+	APIKeySourceStorage = "storage"
+)
+
+// APIKey is a client allowed to call the API, the key itself is never kept, only its SHA-256 hash
+type APIKey struct {
+	Name            string    `json:"name"`
+	Hash            string    `json:"-"`
+	RequestsPerHour int       `json:"requestsPerHour"`
+	Admin           bool      `json:"admin"`
+	Lane            string    `json:"lane,omitempty"`
+	Source          string    `json:"source"`
+	CreatedAt       time.Time `json:"createdAt,omitempty"`
+}
+
+// CreatedAPIKey is returned once when a key is created, the key can't be read again afterwards
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyUsage is the usage of a key since the start of the service.
+// Remaining is the number of Github requests still available in the share of this key
+type APIKeyUsage struct {
+	APIKey
+	Requests       int64      `json:"requests"`
+	Rejected       int64      `json:"rejected"`
+	GithubRequests int64      `json:"githubRequests"`
+	Remaining      int        `json:"remaining"`
+	LastUsedAt     *time.Time `json:"lastUsedAt"`
+}
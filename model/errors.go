@@ -1,35 +1,266 @@
 package model
 
-type APIError struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
-}
-
-func NewAPIError(errReason error) APIError {
-	switch errReason.Error() {
-	case "RATE_LIMIT_REACHED":
-		return APIError{
-			Code:    "RATE_LIMIT_REACHED",
-			Message: "github rate limit reached. consider using a token to increase the limit or wait few minutes and try again",
-		}
-
-	case "RATE_LIMITER_ERROR":
-	case "INVALID_DATA_FOUND":
-	case "FETCH_ERROR":
-		return APIError{
-			Code:    errReason.Error(),
-			Message: "internal server error. contact our support with the reason code for assistance",
-		}
-
-	default:
-		return APIError{
-			Code:    errReason.Error(),
-			Message: "internal server error. contact our support with the reason code for assistance",
-		}
-	}
-
-	return APIError{
-		Code:    "GENERIC_ERROR",
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Non standard status used when the client closes the connection before the response is sent
+const StatusClientClosedRequest = 499
+
+// Content type of the errors returned by the API (RFC 7807)
+const ProblemContentType = "application/problem+json"
+
+// Error is an error returned by the API, with its code and the HTTP status to answer.
+// Errors are declared once below and compared with errors.Is, the cause and the retry hint are added with Wrap and WithRetryAfter
+type Error struct {
+	Code       string
+	Status     int
+	Title      string
+	Message    string
+	RetryAfter time.Duration
+	cause      error
+}
+
+var (
+	ErrRateLimitReached = &Error{
+		Code:    "RATE_LIMIT_REACHED",
+		Status:  http.StatusTooManyRequests,
+		Title:   "Github rate limit reached",
+		Message: "github rate limit reached. consider using a token to increase the limit or wait few minutes and try again",
+	}
+
+	ErrSecondaryRateLimitReached = &Error{
+		Code:    "SECONDARY_RATE_LIMIT_REACHED",
+		Status:  http.StatusTooManyRequests,
+		Title:   "Github secondary rate limit reached",
+		Message: "github secondary rate limit reached. too many requests in a short period, wait few seconds and try again",
+	}
+
+	ErrFilterNotSupported = &Error{
+		Code:    "FILTER_NOT_SUPPORTED",
+		Status:  http.StatusBadRequest,
+		Title:   "Filter not supported",
+		Message: "the license filter is not available when repositories are loaded from github events",
+	}
+
+	ErrInvalidQuery = &Error{
+		Code:    "INVALID_QUERY",
+		Status:  http.StatusBadRequest,
+		Title:   "Invalid query",
+		Message: "query parameters are not valid",
+	}
+
+	ErrInvalidPayload = &Error{
+		Code:    "INVALID_PAYLOAD",
+		Status:  http.StatusBadRequest,
+		Title:   "Invalid payload",
+		Message: "request body is not a valid json payload",
+	}
+
+	ErrUnknownLane = &Error{
+		Code:    "UNKNOWN_LANE",
+		Status:  http.StatusBadRequest,
+		Title:   "Unknown lane",
+		Message: "the priority lane requested is not declared in the configuration",
+	}
+
+	ErrInvalidSignature = &Error{
+		Code:    "INVALID_SIGNATURE",
+		Status:  http.StatusUnauthorized,
+		Title:   "Invalid signature",
+		Message: "the X-Hub-Signature-256 header doesn't match the payload",
+	}
+
+	ErrUnauthorized = &Error{
+		Code:    "UNAUTHORIZED",
+		Status:  http.StatusUnauthorized,
+		Title:   "Unauthorized",
+		Message: "missing or invalid credentials. send an API key in the X-API-Key header or a bearer token in the Authorization header",
+	}
+
+	ErrAuthUnavailable = &Error{
+		Code:    "AUTH_UNAVAILABLE",
+		Status:  http.StatusServiceUnavailable,
+		Title:   "Authentication unavailable",
+		Message: "the keys used to verify bearer tokens can't be loaded. try again in few seconds",
+	}
+
+	ErrForbidden = &Error{
+		Code:    "FORBIDDEN",
+		Status:  http.StatusForbidden,
+		Title:   "Forbidden",
+		Message: "the credentials used don't have the scope required to access this resource",
+	}
+
+	ErrClientQuotaReached = &Error{
+		Code:    "CLIENT_QUOTA_REACHED",
+		Status:  http.StatusTooManyRequests,
+		Title:   "API key quota reached",
+		Message: "the share of github requests of this API key is consumed. wait few minutes and try again",
+	}
+
+	ErrAPIKeyNotFound = &Error{
+		Code:    "API_KEY_NOT_FOUND",
+		Status:  http.StatusNotFound,
+		Title:   "API key not found",
+		Message: "API key not found. keys declared in the config file can't be managed through the API",
+	}
+
+	ErrAPIKeyAlreadyExists = &Error{
+		Code:    "API_KEY_ALREADY_EXISTS",
+		Status:  http.StatusConflict,
+		Title:   "API key already exists",
+		Message: "an API key with the same name already exists",
+	}
+
+	ErrRepositoryNotFound = &Error{
+		Code:    "REPOSITORY_NOT_FOUND",
+		Status:  http.StatusNotFound,
+		Title:   "Repository not found",
+		Message: "repository not found. only repositories already returned by this service have an history",
+	}
+
+	ErrSavedSearchNotFound = &Error{
+		Code:    "SAVED_SEARCH_NOT_FOUND",
+		Status:  http.StatusNotFound,
+		Title:   "Saved search not found",
+		Message: "saved search not found",
+	}
+
+	ErrStorageDisabled = &Error{
+		Code:    "STORAGE_DISABLED",
+		Status:  http.StatusNotImplemented,
+		Title:   "Storage disabled",
+		Message: "this feature is not available because storage is disabled",
+	}
+
+	ErrWebhookDisabled = &Error{
+		Code:    "WEBHOOK_DISABLED",
+		Status:  http.StatusNotImplemented,
+		Title:   "Webhook disabled",
+		Message: "github webhook is disabled because no secret is configured",
+	}
+
+	ErrDeliveryInProgress = &Error{
+		Code:    "DELIVERY_IN_PROGRESS",
+		Status:  http.StatusConflict,
+		Title:   "Webhook delivery in progress",
+		Message: "the same github webhook delivery is currently processed. redeliver it if it fails",
+	}
+
+	ErrUpstreamUnavailable = &Error{
+		Code:    "UPSTREAM_UNAVAILABLE",
+		Status:  http.StatusServiceUnavailable,
+		Title:   "Github unavailable",
+		Message: "github is currently unavailable and no recent result is cached for this search. try again in few seconds",
+	}
+
+	ErrQuotaLow = &Error{
+		Code:    "QUOTA_LOW",
+		Status:  http.StatusServiceUnavailable,
+		Title:   "Github quota low",
+		Message: "github quota is low, only cached results are served until it's reset and this search is not cached. try again after the reset",
+	}
+
+	ErrRequestTimeout = &Error{
+		Code:    "REQUEST_TIMEOUT",
+		Status:  http.StatusGatewayTimeout,
+		Title:   "Request timeout",
+		Message: "github didn't answer in time. try again with more filters to load less repositories",
+	}
+
+	ErrRequestCanceled = &Error{
+		Code:    "REQUEST_CANCELED",
+		Status:  StatusClientClosedRequest,
+		Title:   "Request canceled",
+		Message: "the request has been canceled before the end",
+	}
+
+	ErrRateLimiter        = newInternalError("RATE_LIMITER_ERROR")
+	ErrInvalidData        = newInternalError("INVALID_DATA_FOUND")
+	ErrFetch              = newInternalError("FETCH_ERROR")
+	ErrStorage            = newInternalError("STORAGE_ERROR")
+	ErrNotificationFailed = newInternalError("NOTIFICATION_FAILED")
+	ErrGeneric            = newInternalError("GENERIC_ERROR")
+)
+
+func newInternalError(code string) *Error {
+	return &Error{
+		Code:    code,
+		Status:  http.StatusInternalServerError,
+		Title:   "Internal server error",
 		Message: "internal server error. contact our support with the reason code for assistance",
 	}
 }
+
+// Error returns the code, so errors can still be logged and compared by their code
+func (e *Error) Error() string {
+	return e.Code
+}
+
+// Unwrap returns the cause of the error, if any
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is returns true if the target is an error with the same code, whatever its cause
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Wrap returns a copy of the error caused by another one
+func (e *Error) Wrap(cause error) *Error {
+	wrapped := *e
+	wrapped.cause = cause
+
+	return &wrapped
+}
+
+// WithRetryAfter returns a copy of the error with the delay after which the request can be retried
+func (e *Error) WithRetryAfter(delay time.Duration) *Error {
+	withRetry := *e
+	withRetry.RetryAfter = delay
+
+	return &withRetry
+}
+
+// Problem is the body of errors returned by the API (RFC 7807)
+type Problem struct {
+	Type       string `json:"type"`
+	Title      string `json:"title"`
+	Status     int    `json:"status"`
+	Detail     string `json:"detail"`
+	Instance   string `json:"instance,omitempty"`
+	Code       string `json:"code"`
+	RequestID  string `json:"requestId,omitempty"`
+	RetryAfter int    `json:"retryAfter,omitempty"` // in seconds
+}
+
+// NewProblem creates the body returned for an error. Errors not declared above are returned as GENERIC_ERROR
+func NewProblem(err error, instance string, requestID string) Problem {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = ErrGeneric
+	}
+
+	problem := Problem{
+		Type:      "urn:sclng-backend:problem:" + strings.ToLower(strings.ReplaceAll(apiErr.Code, "_", "-")),
+		Title:     apiErr.Title,
+		Status:    apiErr.Status,
+		Detail:    apiErr.Message,
+		Instance:  instance,
+		Code:      apiErr.Code,
+		RequestID: requestID,
+	}
+
+	// rounded up, so the client doesn't retry too early
+	if apiErr.RetryAfter > 0 {
+		problem.RetryAfter = int((apiErr.RetryAfter + time.Second - 1) / time.Second)
+	}
+
+	return problem
+}
@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 type GithubRepository struct {
 	ID               int64          `json:"-"` // ignored from json only used to fetch languages easily
 	FullName         string         `json:"fullName"`
@@ -8,9 +10,40 @@ type GithubRepository struct {
 	License          string         `json:"license"` // license can be nil, will contains empty string
 	MostUsedLanguage *string        `json:"-"`
 	Languages        map[string]int `json:"languages"`
+	LanguagesStatus  string         `json:"languagesStatus,omitempty"` // only set when languages can be partially loaded
+}
+
+// Status of the languages of a repository, when languages can be partially loaded
+const (
+	LanguagesStatusLoaded           = "loaded"
+	LanguagesStatusSkippedRateLimit = "skipped_rate_limit"
+	LanguagesStatusError            = "error"
+	LanguagesStatusNone             = "none" // repository without any language, nothing to load
+)
+
+// PartialRepositories is the response when languages are loaded within the available rate limit
+type PartialRepositories struct {
+	Repositories []GithubRepository `json:"repositories"`
+	Summary      PartialSummary     `json:"summary"`
+}
+
+// PartialSummary counts the repositories by languages status
+type PartialSummary struct {
+	Count     int               `json:"count"`
+	Statuses  map[string]int    `json:"statuses"`
+	Errors    []RepositoryError `json:"errors"`
+	RateLimit RateLimitState    `json:"rateLimit"`
 }
 
 type GithubRepositoryLanguages struct {
 	RepositoryID int64
 	Languages    map[string]int
+	Error        error
+	Skipped      bool // request not sent because the context was done
+}
+
+// LanguagesSnapshot is the languages of a repository at a given time
+type LanguagesSnapshot struct {
+	FetchedAt time.Time      `json:"fetchedAt"`
+	Languages map[string]int `json:"languages"`
 }
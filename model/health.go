@@ -0,0 +1,56 @@
+package model
+
+import "time"
+
+// Status of each readiness check
+const (
+	HealthStatusOK       = "ok"
+	HealthStatusWarning  = "warning" // reported, but doesn't make the service not ready
+	HealthStatusFailing  = "failing"
+	HealthStatusDisabled = "disabled"
+)
+
+// Readiness reports whether the service can serve /repos, with the state of each dependency
+type Readiness struct {
+	Ready  bool            `json:"ready"`
+	Checks ReadinessChecks `json:"checks"`
+}
+
+type ReadinessChecks struct {
+	Config         HealthCheck   `json:"config"`
+	RateLimiter    HealthCheck   `json:"rateLimiter"`
+	Github         GithubHealth  `json:"github"`
+	CircuitBreaker CircuitHealth `json:"circuitBreaker"`
+	Storage        HealthCheck   `json:"storage"`
+	Cache          CacheHealth   `json:"cache"`
+}
+
+type HealthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// GithubHealth reports if the Github API is reachable, and the quota of each bucket (core, search)
+type GithubHealth struct {
+	HealthCheck
+	CheckedAt        time.Time              `json:"checkedAt"`
+	Buckets          map[string]QuotaBucket `json:"buckets"`
+	LocalRateLimiter RateLimitState         `json:"localRateLimiter"`
+}
+
+// QuotaBucket is the quota of a Github rate limit bucket
+type QuotaBucket struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+}
+
+type CircuitHealth struct {
+	HealthCheck
+	State string `json:"state"`
+}
+
+type CacheHealth struct {
+	HealthCheck
+	Entries int `json:"entries"`
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"sort"
+	"time"
+)
+
+type RepositoryHistory struct {
+	FullName   string                  `json:"fullName"`
+	Owner      string                  `json:"owner"`
+	Repository string                  `json:"repository"`
+	Languages  map[string]int          `json:"languages"`
+	History    []LanguagesHistoryEntry `json:"history"`
+}
+
+// LanguagesHistoryEntry is a languages snapshot with the changes since the previous one
+type LanguagesHistoryEntry struct {
+	FetchedAt time.Time      `json:"fetchedAt"`
+	Languages map[string]int `json:"languages"`
+	Added     []string       `json:"added"`
+	Removed   []string       `json:"removed"`
+	Deltas    map[string]int `json:"deltas"` // bytes difference for each language changed, negative if the language shrinks
+}
+
+// NewRepositoryHistory will build the timeline of a repository from its languages snapshots (oldest first).
+// The first entry is compared to an empty snapshot, so all its languages are considered as added
+func NewRepositoryHistory(repository GithubRepository, snapshots []LanguagesSnapshot) RepositoryHistory {
+	history := RepositoryHistory{
+		FullName:   repository.FullName,
+		Owner:      repository.Owner,
+		Repository: repository.Repository,
+		Languages:  repository.Languages,
+		History:    make([]LanguagesHistoryEntry, 0, len(snapshots)),
+	}
+
+	previous := map[string]int{}
+
+	for _, snapshot := range snapshots {
+		entry := LanguagesHistoryEntry{
+			FetchedAt: snapshot.FetchedAt,
+			Languages: snapshot.Languages,
+			Added:     make([]string, 0),
+			Removed:   make([]string, 0),
+			Deltas:    make(map[string]int),
+		}
+
+		for language, bytes := range snapshot.Languages {
+			previousBytes, found := previous[language]
+
+			if !found {
+				entry.Added = append(entry.Added, language)
+			}
+
+			if bytes != previousBytes {
+				entry.Deltas[language] = bytes - previousBytes
+			}
+		}
+
+		for language, previousBytes := range previous {
+			if _, found := snapshot.Languages[language]; !found {
+				entry.Removed = append(entry.Removed, language)
+				entry.Deltas[language] = -previousBytes
+			}
+		}
+
+		sort.Strings(entry.Added)
+		sort.Strings(entry.Removed)
+
+		history.History = append(history.History, entry)
+		previous = snapshot.Languages
+	}
+
+	return history
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// Notification is the JSON payload sent to the outbound webhook
+type Notification struct {
+	ID     string      `json:"id"`
+	Event  string      `json:"event"`
+	SentAt time.Time   `json:"sentAt"`
+	Data   interface{} `json:"data"`
+}
+
+// DeadLetter is a notification that couldn't be delivered after all attempts
+type DeadLetter struct {
+	Notification Notification `json:"notification"`
+	Attempts     int          `json:"attempts"`
+	LastError    string       `json:"lastError"`
+	FailedAt     time.Time    `json:"failedAt"`
+}
@@ -0,0 +1,36 @@
+package model
+
+import "slices"
+
+// Kind of credentials used to authenticate a request
+const (
+	PrincipalTypeAPIKey = "api_key"
+	PrincipalTypeJWT    = "jwt"
+)
+
+// Scopes required by the routes of the API
+const (
+	ScopeReposRead     = "repos:read"
+	ScopeStatsRead     = "stats:read"
+	ScopeSearchesWrite = "searches:write"
+	ScopeAdmin         = "admin"
+)
+
+// Principal is the client behind an authenticated request: the name of the API key, or the subject of the bearer token.
+// Lane is the priority lane of the API key, if any
+type Principal struct {
+	Type   string   `json:"type"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	Lane   string   `json:"lane,omitempty"`
+}
+
+// ID identifies the principal in logs and quota accounting, keys and token subjects can't collide
+func (p Principal) ID() string {
+	return p.Type + ":" + p.Name
+}
+
+// HasScope returns true if the principal is allowed to access routes requiring this scope
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
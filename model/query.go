@@ -3,9 +3,9 @@ package model
 import "strings"
 
 type SearchQuery struct {
-	Owner    string `form:"owner"`
-	License  string `form:"license"`
-	Language string `form:"language"`
+	Owner    string `form:"owner" json:"owner"`
+	License  string `form:"license" json:"license"`
+	Language string `form:"language" json:"language"`
 }
 
 func (params SearchQuery) ToGithubQuery(filterPublicRepositories bool) string {
@@ -29,3 +29,33 @@ func (params SearchQuery) ToGithubQuery(filterPublicRepositories bool) string {
 
 	return strings.TrimSpace(githubQuery.String())
 }
+
+// Match checks if a repository matches the query filters.
+// Used when repositories are not fetched with the Search API, so filters must be applied locally
+func (params SearchQuery) Match(repository GithubRepository) bool {
+	if params.Owner != "" && !strings.EqualFold(params.Owner, repository.Owner) {
+		return false
+	}
+
+	if params.License != "" && !strings.EqualFold(params.License, repository.License) {
+		return false
+	}
+
+	// like the language qualifier of the Search API, only the most used language of the repository matches
+	if params.Language != "" {
+		return repository.MostUsedLanguage != nil && strings.EqualFold(params.Language, *repository.MostUsedLanguage)
+	}
+
+	return true
+}
+
+// Key returns a normalized representation of the query, so equivalent queries (case, spaces) share the same key
+func (params SearchQuery) Key() string {
+	normalized := SearchQuery{
+		Owner:    strings.ToLower(strings.TrimSpace(params.Owner)),
+		License:  strings.ToLower(strings.TrimSpace(params.License)),
+		Language: strings.ToLower(strings.TrimSpace(params.Language)),
+	}
+
+	return normalized.ToGithubQuery(false)
+}
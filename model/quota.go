@@ -0,0 +1,44 @@
+package model
+
+import "time"
+
+// QuotaStatus is the view of the service on each Github rate limit bucket (core, search)
+type QuotaStatus struct {
+	CacheOnly        bool                         `json:"cacheOnly"`
+	Buckets          map[string]QuotaBucketStatus `json:"buckets"`
+	LocalRateLimiter RateLimitState               `json:"localRateLimiter"`
+	Lanes            map[string]RateLimitState    `json:"lanes,omitempty"`
+}
+
+// QuotaBucketStatus is the last quota of a bucket sent by Github, with the local usage of this bucket.
+// Reserved is the number of tokens reserved by requests still running, not sent to Github yet
+type QuotaBucketStatus struct {
+	QuotaBucket
+	Reserved         int       `json:"reserved"`
+	ConsumedLastHour int       `json:"consumedLastHour"`
+	LowWaterMark     int       `json:"lowWaterMark"`
+	Low              bool      `json:"low"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+// QuotaAlert is the payload sent to the webhook when a bucket goes under its low-water mark, or above it again
+type QuotaAlert struct {
+	Event        string    `json:"-"`
+	Bucket       string    `json:"bucket"`
+	Limit        int       `json:"limit"`
+	Remaining    int       `json:"remaining"`
+	LowWaterMark int       `json:"lowWaterMark"`
+	Reset        time.Time `json:"reset"`
+}
+
+// CostEstimate is the number of Github requests a /repos query would consume, computed with the search only.
+// Cost and Remaining are given by bucket (core, search), Remaining only holds the buckets known by the service
+type CostEstimate struct {
+	Repositories              int            `json:"repositories"`
+	RepositoriesWithLanguages int            `json:"repositoriesWithLanguages"`
+	CacheHits                 int            `json:"cacheHits"`
+	CacheOnly                 bool           `json:"cacheOnly"`
+	Cost                      map[string]int `json:"cost"`
+	Remaining                 map[string]int `json:"remaining"`
+	WithinQuota               bool           `json:"withinQuota"`
+}
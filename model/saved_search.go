@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+type SavedSearch struct {
+	ID        string      `json:"id"`
+	Name      string      `json:"name"`
+	Query     SearchQuery `json:"query"`
+	CreatedAt time.Time   `json:"createdAt"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+	LastRunAt *time.Time  `json:"lastRunAt"`
+}
+
+// SavedSearchNotification is the payload sent to the webhook when new repositories match a saved search
+type SavedSearchNotification struct {
+	Search       SavedSearch        `json:"search"`
+	Repositories []GithubRepository `json:"repositories"`
+}
@@ -0,0 +1,34 @@
+package model
+
+// Types of events sent when repositories are streamed
+const (
+	StreamEventRepository = "repository"
+	StreamEventSummary    = "summary"
+)
+
+// StreamEvent is a single message sent when repositories are streamed.
+// Only the field matching the type is set
+type StreamEvent struct {
+	Type       string            `json:"type"`
+	Repository *GithubRepository `json:"repository,omitempty"`
+	Summary    *StreamSummary    `json:"summary,omitempty"`
+}
+
+// StreamSummary is the last message sent when repositories are streamed
+type StreamSummary struct {
+	Count     int               `json:"count"`
+	Errors    []RepositoryError `json:"errors"`
+	RateLimit RateLimitState    `json:"rateLimit"`
+}
+
+// RepositoryError reports a repository for which languages couldn't be loaded
+type RepositoryError struct {
+	FullName string `json:"fullName"`
+	Code     string `json:"code"`
+}
+
+// RateLimitState is the state of the local rate limiter
+type RateLimitState struct {
+	Limit     int `json:"limit"`
+	Remaining int `json:"remaining"`
+}
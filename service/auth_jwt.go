@@ -0,0 +1,343 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+// Minimum delay between two loads of the JWKS triggered by an unknown key ID,
+// so tokens signed with random key IDs can't be used to flood the JWKS endpoint
+const jwksMinReloadInterval = 10 * time.Second
+
+// Signature algorithms accepted, only asymmetric ones since the keys come from a JWKS
+var jwtValidMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+var (
+	errJWKSUnavailable = errors.New("JWKS unavailable")
+	errJWKSKeyNotFound = errors.New("no key found in the JWKS for this token")
+	errJWTNoSubject    = errors.New("token without subject")
+)
+
+// jwtVerifier checks the signature of bearer tokens with the keys of a JWKS, then their issuer, audience and expiration
+type jwtVerifier struct {
+	jwks   *jwks
+	parser *jwt.Parser
+}
+
+// tokenClaims are the claims read from bearer tokens. Scopes are either in a space separated scope claim (OAuth 2.0)
+// or in a scp claim, a string or a list depending on the issuer
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Scope string           `json:"scope"`
+	Scp   jwt.ClaimStrings `json:"scp"`
+}
+
+func newJWTVerifier(config config.AuthConfig, httpClient *http.Client) *jwtVerifier {
+	return &jwtVerifier{
+		jwks: &jwks{
+			file:            config.JWKSFile,
+			url:             config.JWKSURL,
+			refreshInterval: time.Duration(config.JWKSRefreshInterval) * time.Second,
+			httpClient:      httpClient,
+		},
+		parser: jwt.NewParser(
+			jwt.WithValidMethods(jwtValidMethods),
+			jwt.WithIssuer(config.JWTIssuer),
+			jwt.WithAudience(config.JWTAudience),
+			jwt.WithExpirationRequired(),
+			jwt.WithLeeway(30*time.Second),
+		),
+	}
+}
+
+// verify returns the principal of a valid token, the subject with the scopes of the token
+func (v *jwtVerifier) verify(ctx context.Context, token string) (model.Principal, error) {
+	claims := tokenClaims{}
+
+	_, err := v.parser.ParseWithClaims(token, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.jwks.key(ctx, kid)
+	})
+	if err != nil {
+		return model.Principal{}, err
+	}
+
+	if claims.Subject == "" {
+		return model.Principal{}, errJWTNoSubject
+	}
+
+	scopes := strings.Fields(claims.Scope)
+	scopes = append(scopes, claims.Scp...)
+
+	return model.Principal{
+		Type:   model.PrincipalTypeJWT,
+		Name:   claims.Subject,
+		Scopes: scopes,
+	}, nil
+}
+
+// jwks keeps the public keys of a JWKS, by key ID, loaded from a file or a URL on first use
+// and again once the refresh interval is passed, or when a token is signed with an unknown key ID
+type jwks struct {
+	file            string
+	url             string
+	refreshInterval time.Duration
+	httpClient      *http.Client
+
+	// loads shares a load between the requests waiting for it, the lock is not held while loading
+	loads singleflight.Group
+
+	mu       sync.Mutex
+	keys     map[string]crypto.PublicKey
+	loadErr  error
+	loadedAt time.Time
+	triedAt  time.Time
+}
+
+// jsonWebKey is a public key of a JWKS (RFC 7517), only the members needed for RSA, EC and Ed25519 keys are read
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// key returns the key with this ID. A token without key ID can only be verified if the JWKS has a single key
+func (j *jwks) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	if j.needsReload(kid) {
+		// the load goes on for the other requests if this one is canceled
+		result := j.loads.DoChan("jwks", func() (interface{}, error) {
+			j.reload(context.WithoutCancel(ctx))
+			return nil, nil
+		})
+
+		select {
+		case <-result:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	// keys already loaded are still used if the JWKS can't be loaded again
+	if j.keys == nil {
+		return nil, j.loadErr
+	}
+
+	if kid == "" && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, nil
+		}
+	}
+
+	key, found := j.keys[kid]
+	if !found {
+		return nil, errJWKSKeyNotFound
+	}
+
+	return key, nil
+}
+
+// needsReload returns true if the keys are not loaded yet, are expired or don't include this key ID
+func (j *jwks) needsReload(kid string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	_, known := j.keys[kid]
+
+	return j.keys == nil || (j.refreshInterval > 0 && time.Since(j.loadedAt) > j.refreshInterval) || (kid != "" && !known)
+}
+
+// reload loads the JWKS again, unless it has been tried less than jwksMinReloadInterval ago
+func (j *jwks) reload(ctx context.Context) {
+	j.mu.Lock()
+	now := time.Now()
+	if now.Sub(j.triedAt) <= jwksMinReloadInterval {
+		j.mu.Unlock()
+		return
+	}
+	j.triedAt = now
+	j.mu.Unlock()
+
+	keys, err := j.load(ctx)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err != nil {
+		j.loadErr = fmt.Errorf("%w: %w", errJWKSUnavailable, err)
+		return
+	}
+
+	j.keys = keys
+	j.loadErr = nil
+	j.loadedAt = now
+}
+
+func (j *jwks) load(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	var data []byte
+	var err error
+
+	if j.file != "" {
+		data, err = os.ReadFile(j.file)
+	} else {
+		data, err = j.fetch(ctx)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to load JWKS: %w", err)
+	}
+
+	return parseJWKS(data)
+}
+
+func (j *jwks) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := j.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d from %s", res.StatusCode, j.url)
+	}
+
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
+
+// parseJWKS returns the signature keys of a JWKS by key ID, keys of unsupported types or used for encryption are skipped
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q in JWKS: %w", jwk.Kid, err)
+		}
+
+		if key != nil {
+			keys[jwk.Kid] = key
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no signature key in JWKS")
+	}
+
+	return keys, nil
+}
+
+// publicKey returns the key, nil if its type is not supported
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() {
+			return nil, errors.New("exponent too large")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, nil
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid base64url integer")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
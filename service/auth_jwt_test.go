@@ -0,0 +1,292 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeBigInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+// testJWKS returns the JWKS of the public keys, by key ID
+func testJWKS(t *testing.T, rsaKeys map[string]*rsa.PrivateKey, ecKeys map[string]*ecdsa.PrivateKey) []byte {
+	keys := []jsonWebKey{}
+
+	for kid, key := range rsaKeys {
+		keys = append(keys, jsonWebKey{Kty: "RSA", Kid: kid, Use: "sig", N: encodeBigInt(key.N), E: encodeBigInt(big.NewInt(int64(key.E)))})
+	}
+
+	for kid, key := range ecKeys {
+		keys = append(keys, jsonWebKey{Kty: "EC", Kid: kid, Crv: "P-256", X: encodeBigInt(key.X), Y: encodeBigInt(key.Y)})
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	assert.NoError(t, err)
+
+	return data
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	assert.NoError(t, err)
+
+	return signed
+}
+
+// TestAuthenticateBearerToken checks that tokens signed with a key of the JWKS file are accepted,
+// only with the expected issuer and audience
+func TestAuthenticateBearerToken(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(jwksFile, testJWKS(t, map[string]*rsa.PrivateKey{"rsa": rsaKey}, map[string]*ecdsa.PrivateKey{"ec": ecKey}), 0o600))
+
+	conf := config.GetDefault()
+	conf.Auth.JWKSFile = jwksFile
+	conf.Auth.JWTIssuer = "https://auth.example.com"
+	conf.Auth.JWTAudience = "sclng-backend"
+
+	svc := NewAuthService(*conf, storage.NewNoopStorage())
+
+	claims := func(overrides jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss": "https://auth.example.com",
+			"aud": "sclng-backend",
+			"sub": "user-42",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+
+		for k, v := range overrides {
+			c[k] = v
+		}
+
+		return c
+	}
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedScopes []string
+		expectedError  string
+	}{
+		{
+			name:           "RSA key with scope claim",
+			token:          signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"scope": "repos:read stats:read"})),
+			expectedScopes: []string{model.ScopeReposRead, model.ScopeStatsRead},
+		},
+		{
+			name:           "EC key with scp claim",
+			token:          signToken(t, jwt.SigningMethodES256, "ec", ecKey, claims(jwt.MapClaims{"scp": []string{"admin"}})),
+			expectedScopes: []string{model.ScopeAdmin},
+		},
+		{
+			name:           "audience in a list",
+			token:          signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"aud": []string{"other", "sclng-backend"}})),
+			expectedScopes: []string{},
+		},
+		{
+			name:          "unknown key",
+			token:         signToken(t, jwt.SigningMethodRS256, "rsa", otherKey, claims(nil)),
+			expectedError: "UNAUTHORIZED",
+		},
+		{
+			name:          "unknown key ID",
+			token:         signToken(t, jwt.SigningMethodRS256, "other", otherKey, claims(nil)),
+			expectedError: "UNAUTHORIZED",
+		},
+		{
+			name:          "symmetric algorithm",
+			token:         signToken(t, jwt.SigningMethodHS256, "rsa", []byte("secret"), claims(nil)),
+			expectedError: "UNAUTHORIZED",
+		},
+		{
+			name:          "wrong issuer",
+			token:         signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"iss": "https://evil.example.com"})),
+			expectedError: "UNAUTHORIZED",
+		},
+		{
+			name:          "wrong audience",
+			token:         signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"aud": "other"})),
+			expectedError: "UNAUTHORIZED",
+		},
+		{
+			name:          "expired",
+			token:         signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()})),
+			expectedError: "UNAUTHORIZED",
+		},
+		{
+			name:          "without subject",
+			token:         signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"sub": ""})),
+			expectedError: "UNAUTHORIZED",
+		},
+		{
+			name:          "not a token",
+			token:         "not-a-token",
+			expectedError: "UNAUTHORIZED",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, principal, err := svc.Authenticate(context.Background(), "", tt.token)
+
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				assert.Nil(t, apiClientFromContext(ctx))
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, model.Principal{Type: model.PrincipalTypeJWT, Name: "user-42", Scopes: tt.expectedScopes}, principal)
+			assert.NotNil(t, apiClientFromContext(ctx))
+		})
+	}
+
+	// all tokens of a subject share the same part of the Github budget
+	ctx1, _, err := svc.Authenticate(context.Background(), "", tests[0].token)
+	assert.NoError(t, err)
+
+	ctx2, _, err := svc.Authenticate(context.Background(), "", tests[1].token)
+	assert.NoError(t, err)
+
+	assert.Same(t, apiClientFromContext(ctx1), apiClientFromContext(ctx2))
+	assert.Equal(t, conf.Auth.DefaultRequestsPerHour, apiClientFromContext(ctx1).requestsPerHour)
+}
+
+// TestAuthenticateBearerTokenJWKSURL checks that the JWKS is loaded from its URL, and loaded again for a new key ID
+func TestAuthenticateBearerTokenJWKSURL(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	calls := 0
+	jwksData := testJWKS(t, map[string]*rsa.PrivateKey{"old": oldKey}, nil)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write(jwksData)
+	}))
+	defer server.Close()
+
+	conf := config.GetDefault()
+	conf.Auth.JWKSURL = server.URL
+	conf.Auth.JWTIssuer = "https://auth.example.com"
+	conf.Auth.JWTAudience = "sclng-backend"
+
+	svc := NewAuthService(*conf, storage.NewNoopStorage()).(authService)
+
+	claims := jwt.MapClaims{
+		"iss": "https://auth.example.com",
+		"aud": "sclng-backend",
+		"sub": "user-42",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+
+	for i := 0; i < 2; i++ {
+		_, _, err = svc.Authenticate(context.Background(), "", signToken(t, jwt.SigningMethodRS256, "old", oldKey, claims))
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, 1, calls)
+
+	// the keys are rotated, the JWKS is loaded again once the minimum delay between two loads is passed
+	jwksData = testJWKS(t, map[string]*rsa.PrivateKey{"new": newKey}, nil)
+	svc.verifier.jwks.triedAt = time.Now().Add(-jwksMinReloadInterval - time.Second)
+
+	_, _, err = svc.Authenticate(context.Background(), "", signToken(t, jwt.SigningMethodRS256, "new", newKey, claims))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	// unknown key IDs don't trigger another load before the minimum delay
+	_, _, err = svc.Authenticate(context.Background(), "", signToken(t, jwt.SigningMethodRS256, "unknown", newKey, claims))
+	assert.EqualError(t, err, "UNAUTHORIZED")
+	assert.Equal(t, 2, calls)
+}
+
+// TestAuthenticateBearerTokenJWKSUnavailable checks that tokens are not refused but can't be verified while the JWKS can't be loaded,
+// and that the load is not canceled with the request
+func TestAuthenticateBearerTokenJWKSUnavailable(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	available := false
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		if !available {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(testJWKS(t, map[string]*rsa.PrivateKey{"rsa": key}, nil))
+	}))
+	defer server.Close()
+
+	conf := config.GetDefault()
+	conf.Auth.JWKSURL = server.URL
+	conf.Auth.JWTIssuer = "https://auth.example.com"
+	conf.Auth.JWTAudience = "sclng-backend"
+
+	svc := NewAuthService(*conf, storage.NewNoopStorage()).(authService)
+
+	token := signToken(t, jwt.SigningMethodRS256, "rsa", key, jwt.MapClaims{
+		"iss": "https://auth.example.com",
+		"aud": "sclng-backend",
+		"sub": "user-42",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	// the request is canceled while the JWKS is loading, the load goes on
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err = svc.Authenticate(ctx, "", token)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	close(release)
+
+	_, _, err = svc.Authenticate(context.Background(), "", token)
+	assert.ErrorIs(t, err, model.ErrAuthUnavailable)
+
+	// the JWKS is loaded once the minimum delay between two loads is passed
+	available = true
+	svc.verifier.jwks.mu.Lock()
+	svc.verifier.jwks.triedAt = time.Now().Add(-jwksMinReloadInterval - time.Second)
+	svc.verifier.jwks.mu.Unlock()
+
+	_, _, err = svc.Authenticate(context.Background(), "", token)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,401 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/metrics"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// Prefix of the API keys generated, to recognize them easily in logs or secret scanners
+const apiKeyPrefix = "sclng_"
+
+// Token subjects unused for this delay are forgotten, their share of the Github budget is refilled by then anyway
+const tokenClientIdleTimeout = time.Hour
+
+type AuthService interface {
+	Authenticate(ctx context.Context, apiKey string, bearerToken string) (context.Context, model.Principal, error)
+	CountRejected(ctx context.Context)
+
+	CreateKey(key model.APIKey) (model.CreatedAPIKey, error)
+	ListKeys() ([]model.APIKeyUsage, error)
+	DeleteKey(name string) error
+}
+
+type authService struct {
+	configKeys map[string]model.APIKey
+	clients    *apiClients
+	verifier   *jwtVerifier
+	storage    storage.Storage
+	config     config.Config
+}
+
+// apiClients keeps the limiter and the usage of each API key and token subject, by principal ID.
+// Any subject signed by the issuer adds a client, so idle token subjects are evicted
+type apiClients struct {
+	mu      sync.Mutex
+	clients map[string]*apiClient
+	sweptAt time.Time
+}
+
+// apiClient is an API key or a token subject seen since the start of the service.
+// Its limiter holds the share of the Github budget of the client, used in front of the Github rate limiter
+type apiClient struct {
+	requestsPerHour int
+	limiter         *rate.Limiter
+	requests        atomic.Int64
+	rejected        atomic.Int64
+	githubRequests  atomic.Int64
+	lastUsedAt      atomic.Int64 // unix nanoseconds, 0 if never used
+}
+
+type apiClientContextKey struct{}
+
+// NewAuthService will create an instance of AuthService, with the keys declared in the config file
+func NewAuthService(config config.Config, storage storage.Storage) AuthService {
+	configKeys := make(map[string]model.APIKey, len(config.Auth.Keys))
+
+	for _, key := range config.Auth.Keys {
+		hash := strings.ToLower(strings.TrimSpace(key.Hash))
+
+		configKeys[hash] = model.APIKey{
+			Name:            key.Name,
+			Hash:            hash,
+			RequestsPerHour: key.RequestsPerHour,
+			Admin:           key.Admin,
+			Lane:            key.Lane,
+			Source:          model.APIKeySourceConfig,
+		}
+	}
+
+	var verifier *jwtVerifier
+
+	switch {
+	case config.Auth.JWKSFile == "" && config.Auth.JWKSURL == "":
+		// bearer tokens are not used, only API keys
+	case config.Auth.JWTIssuer == "" || config.Auth.JWTAudience == "":
+		log.Error("JWKS configured without JWTIssuer or JWTAudience, bearer tokens will be refused")
+	default:
+		verifier = newJWTVerifier(config.Auth, &http.Client{Timeout: 10 * time.Second})
+	}
+
+	return authService{
+		configKeys: configKeys,
+		clients:    &apiClients{clients: make(map[string]*apiClient)},
+		verifier:   verifier,
+		storage:    storage,
+		config:     config,
+	}
+}
+
+// HashAPIKey returns the hex encoded SHA-256 of the key, the only form in which keys are kept
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticate finds the client behind a bearer token or an API key, and counts the request in its usage.
+// The returned context holds the share of the Github budget of the client, used by the Github service for each request
+func (s authService) Authenticate(ctx context.Context, apiKey string, bearerToken string) (context.Context, model.Principal, error) {
+	var principal model.Principal
+	var requestsPerHour int
+	var err error
+
+	switch {
+	case bearerToken != "":
+		principal, err = s.authenticateToken(ctx, bearerToken)
+		requestsPerHour = s.config.Auth.DefaultRequestsPerHour
+	case apiKey != "":
+		var key model.APIKey
+
+		key, err = s.authenticateKey(ctx, apiKey)
+		principal = apiKeyPrincipal(key)
+		requestsPerHour = s.requestsPerHour(key)
+	default:
+		err = model.ErrUnauthorized
+	}
+
+	if err != nil {
+		return ctx, model.Principal{}, err
+	}
+
+	client := s.client(principal.ID(), requestsPerHour)
+	client.requests.Add(1)
+	client.lastUsedAt.Store(time.Now().UnixNano())
+
+	// token subjects are not declared by admins, they are counted together to keep the number of series low
+	label := principal.Name
+	if principal.Type == model.PrincipalTypeJWT {
+		label = model.PrincipalTypeJWT
+	}
+
+	metrics.APIKeyRequests.WithLabelValues(label).Inc()
+
+	return context.WithValue(ctx, apiClientContextKey{}, client), principal, nil
+}
+
+// authenticateKey finds the API key, declared in the config file or created in storage
+func (s authService) authenticateKey(ctx context.Context, key string) (model.APIKey, error) {
+	hash := HashAPIKey(key)
+
+	if apiKey, found := s.configKeys[hash]; found {
+		return apiKey, nil
+	}
+
+	apiKey, err := s.storage.GetAPIKey(hash)
+	if errors.Is(err, storage.ErrAPIKeyNotFound) {
+		return model.APIKey{}, model.ErrUnauthorized
+	}
+
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("unable to load API key from storage")
+		return model.APIKey{}, model.ErrStorage.Wrap(err)
+	}
+
+	return apiKey, nil
+}
+
+// authenticateToken verifies a bearer token, refused if no JWKS is configured
+func (s authService) authenticateToken(ctx context.Context, token string) (model.Principal, error) {
+	if s.verifier == nil {
+		return model.Principal{}, model.ErrUnauthorized
+	}
+
+	principal, err := s.verifier.verify(ctx, token)
+	if err != nil {
+		// the token can't be verified without the JWKS, it's not refused
+		if errors.Is(err, errJWKSUnavailable) {
+			log.WithContext(ctx).WithError(err).Error("unable to verify bearer token")
+			return model.Principal{}, model.ErrAuthUnavailable.Wrap(err)
+		}
+
+		log.WithContext(ctx).WithError(err).Info("bearer token refused")
+		return model.Principal{}, model.ErrUnauthorized.Wrap(err)
+	}
+
+	return principal, nil
+}
+
+// apiKeyPrincipal returns the principal of an API key. Keys can read everything, only admin keys can manage saved searches and keys
+func apiKeyPrincipal(key model.APIKey) model.Principal {
+	scopes := []string{model.ScopeReposRead, model.ScopeStatsRead}
+	if key.Admin {
+		scopes = append(scopes, model.ScopeSearchesWrite, model.ScopeAdmin)
+	}
+
+	return model.Principal{
+		Type:   model.PrincipalTypeAPIKey,
+		Name:   key.Name,
+		Scopes: scopes,
+		Lane:   key.Lane,
+	}
+}
+
+// CountRejected counts a request of the client rejected because a rate limit is reached
+func (s authService) CountRejected(ctx context.Context) {
+	if client := apiClientFromContext(ctx); client != nil {
+		client.rejected.Add(1)
+	}
+}
+
+// requestsPerHour returns the share of the Github budget of an API key, the default one if not set
+func (s authService) requestsPerHour(key model.APIKey) int {
+	if key.RequestsPerHour <= 0 {
+		return s.config.Auth.DefaultRequestsPerHour
+	}
+
+	return key.RequestsPerHour
+}
+
+// client returns the limiter and usage of a client, created on first use.
+// The limiter is created again if the quota of the client changed
+func (s authService) client(id string, requestsPerHour int) *apiClient {
+	s.clients.mu.Lock()
+	defer s.clients.mu.Unlock()
+
+	client, found := s.clients.clients[id]
+	if found && client.requestsPerHour == requestsPerHour {
+		return client
+	}
+
+	s.clients.evictIdleTokens(time.Now())
+
+	updated := &apiClient{
+		requestsPerHour: requestsPerHour,
+		limiter:         rate.NewLimiter(rate.Every(time.Hour/time.Duration(requestsPerHour)), requestsPerHour),
+	}
+
+	// usage is kept when the quota is updated
+	if found {
+		updated.requests.Store(client.requests.Load())
+		updated.rejected.Store(client.rejected.Load())
+		updated.githubRequests.Store(client.githubRequests.Load())
+		updated.lastUsedAt.Store(client.lastUsedAt.Load())
+	}
+
+	s.clients.clients[id] = updated
+
+	return updated
+}
+
+// evictIdleTokens removes the token subjects unused for tokenClientIdleTimeout, at most once a minute.
+// API keys are kept, their usage is listed until the service restarts
+func (c *apiClients) evictIdleTokens(now time.Time) {
+	if now.Sub(c.sweptAt) < time.Minute {
+		return
+	}
+
+	c.sweptAt = now
+
+	for id, client := range c.clients {
+		lastUsedAt := client.lastUsedAt.Load()
+
+		if strings.HasPrefix(id, model.PrincipalTypeJWT+":") && lastUsedAt > 0 && now.Sub(time.Unix(0, lastUsedAt)) > tokenClientIdleTimeout {
+			delete(c.clients, id)
+		}
+	}
+}
+
+// apiClientFromContext returns the client of the request, nil if the request is not authenticated
+func apiClientFromContext(ctx context.Context) *apiClient {
+	client, _ := ctx.Value(apiClientContextKey{}).(*apiClient)
+	return client
+}
+
+// CreateKey generates a new API key kept in storage. The key is only returned here, only its hash is kept
+func (s authService) CreateKey(key model.APIKey) (model.CreatedAPIKey, error) {
+	if !s.config.Storage.Enabled {
+		return model.CreatedAPIKey{}, model.ErrStorageDisabled
+	}
+
+	key.Name = strings.TrimSpace(key.Name)
+	if key.Name == "" || key.RequestsPerHour < 0 {
+		return model.CreatedAPIKey{}, model.ErrInvalidPayload
+	}
+
+	if key.Lane != "" && !s.config.Lanes.HasLane(key.Lane) {
+		return model.CreatedAPIKey{}, model.ErrUnknownLane
+	}
+
+	keys, err := s.allKeys()
+	if err != nil {
+		return model.CreatedAPIKey{}, err
+	}
+
+	for _, existing := range keys {
+		if existing.Name == key.Name {
+			return model.CreatedAPIKey{}, model.ErrAPIKeyAlreadyExists
+		}
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return model.CreatedAPIKey{}, model.ErrGeneric.Wrap(err)
+	}
+
+	plain := apiKeyPrefix + hex.EncodeToString(b)
+
+	key.Hash = HashAPIKey(plain)
+	key.Source = model.APIKeySourceStorage
+	key.CreatedAt = time.Now().UTC()
+
+	if err := s.storage.SaveAPIKey(key); err != nil {
+		log.WithError(err).Error("unable to save API key in storage")
+		return model.CreatedAPIKey{}, model.ErrStorage.Wrap(err)
+	}
+
+	log.WithField("name", key.Name).Info("API key created")
+
+	return model.CreatedAPIKey{APIKey: key, Key: plain}, nil
+}
+
+// ListKeys returns all API keys with their usage since the start of the service, sorted by name
+func (s authService) ListKeys() ([]model.APIKeyUsage, error) {
+	keys, err := s.allKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	usages := make([]model.APIKeyUsage, 0, len(keys))
+
+	for _, key := range keys {
+		key.RequestsPerHour = s.requestsPerHour(key)
+		client := s.client(apiKeyPrincipal(key).ID(), key.RequestsPerHour)
+
+		usage := model.APIKeyUsage{
+			APIKey:         key,
+			Requests:       client.requests.Load(),
+			Rejected:       client.rejected.Load(),
+			GithubRequests: client.githubRequests.Load(),
+			Remaining:      int(client.limiter.Tokens()),
+		}
+
+		if lastUsedAt := client.lastUsedAt.Load(); lastUsedAt > 0 {
+			t := time.Unix(0, lastUsedAt).UTC()
+			usage.LastUsedAt = &t
+		}
+
+		usages = append(usages, usage)
+	}
+
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].Name < usages[j].Name
+	})
+
+	return usages, nil
+}
+
+// DeleteKey deletes an API key kept in storage, keys declared in the config file can't be deleted
+func (s authService) DeleteKey(name string) error {
+	if !s.config.Storage.Enabled {
+		return model.ErrStorageDisabled
+	}
+
+	err := s.storage.DeleteAPIKey(name)
+	if errors.Is(err, storage.ErrAPIKeyNotFound) {
+		return model.ErrAPIKeyNotFound.Wrap(err)
+	}
+
+	if err != nil {
+		log.WithError(err).Error("unable to delete API key from storage")
+		return model.ErrStorage.Wrap(err)
+	}
+
+	s.clients.mu.Lock()
+	delete(s.clients.clients, apiKeyPrincipal(model.APIKey{Name: name}).ID())
+	s.clients.mu.Unlock()
+
+	log.WithField("name", name).Info("API key deleted")
+
+	return nil
+}
+
+// allKeys returns the keys declared in the config file and the ones kept in storage
+func (s authService) allKeys() ([]model.APIKey, error) {
+	keys := make([]model.APIKey, 0, len(s.configKeys))
+	for _, key := range s.configKeys {
+		keys = append(keys, key)
+	}
+
+	stored, err := s.storage.ListAPIKeys()
+	if err != nil {
+		log.WithError(err).Error("unable to list API keys from storage")
+		return nil, model.ErrStorage.Wrap(err)
+	}
+
+	return append(keys, stored...), nil
+}
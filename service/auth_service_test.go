@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	"github.com/google/go-github/v66/github"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+// TestAuthenticate checks that keys are found from the config file and from storage, only using their hash
+func TestAuthenticate(t *testing.T) {
+	conf := config.GetDefault()
+	conf.Storage.Enabled = true
+	conf.Storage.Path = filepath.Join(t.TempDir(), "storage.db")
+	conf.Auth.Keys = []config.APIKeyConfig{{Name: "ci", Hash: HashAPIKey("config-key"), RequestsPerHour: 10}}
+
+	store, err := storage.NewBoltStorage(conf.Storage)
+	assert.NoError(t, err)
+
+	defer store.Close()
+
+	svc := NewAuthService(*conf, store)
+
+	created, err := svc.CreateKey(model.APIKey{Name: "partner", Admin: true})
+	assert.NoError(t, err)
+	assert.Equal(t, HashAPIKey(created.Key), created.Hash)
+
+	_, err = svc.CreateKey(model.APIKey{Name: "ci"})
+	assert.EqualError(t, err, "API_KEY_ALREADY_EXISTS")
+
+	tests := []struct {
+		name          string
+		key           string
+		expectedName  string
+		expectedAdmin bool
+		expectedError string
+	}{
+		{name: "config key", key: "config-key", expectedName: "ci"},
+		{name: "stored key", key: created.Key, expectedName: "partner", expectedAdmin: true},
+		{name: "unknown key", key: "unknown", expectedError: "UNAUTHORIZED"},
+		{name: "missing key", key: "", expectedError: "UNAUTHORIZED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, principal, err := svc.Authenticate(context.Background(), tt.key, "")
+
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				assert.Nil(t, apiClientFromContext(ctx))
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedName, principal.Name)
+			assert.Equal(t, model.PrincipalTypeAPIKey, principal.Type)
+			assert.True(t, principal.HasScope(model.ScopeReposRead))
+			assert.Equal(t, tt.expectedAdmin, principal.HasScope(model.ScopeSearchesWrite))
+			assert.Equal(t, tt.expectedAdmin, principal.HasScope(model.ScopeAdmin))
+			assert.NotNil(t, apiClientFromContext(ctx))
+		})
+	}
+
+	usages, err := svc.ListKeys()
+	assert.NoError(t, err)
+	assert.Len(t, usages, 2)
+	assert.Equal(t, "ci", usages[0].Name)
+	assert.Equal(t, int64(1), usages[0].Requests)
+	assert.Equal(t, 10, usages[0].RequestsPerHour)
+	assert.Equal(t, conf.Auth.DefaultRequestsPerHour, usages[1].RequestsPerHour)
+
+	assert.NoError(t, svc.DeleteKey("partner"))
+	assert.EqualError(t, svc.DeleteKey("ci"), "API_KEY_NOT_FOUND")
+
+	_, _, err = svc.Authenticate(context.Background(), created.Key, "")
+	assert.EqualError(t, err, "UNAUTHORIZED")
+}
+
+// TestReserveTokensWithAPIKey checks that tokens are taken from the share of the key before the Github rate limiter
+func TestReserveTokensWithAPIKey(t *testing.T) {
+	conf := config.GetDefault()
+	conf.Auth.Keys = []config.APIKeyConfig{{Name: "ci", Hash: HashAPIKey("config-key"), RequestsPerHour: 3}}
+
+	githubRateLimiter := rate.NewLimiter(rate.Every(time.Hour), 10)
+	svc := NewGithubService(*conf, github.NewClient(nil), githubRateLimiter, storage.NewNoopStorage()).(githubService)
+	auth := NewAuthService(*conf, storage.NewNoopStorage())
+
+	ctx, _, err := auth.Authenticate(context.Background(), "config-key", "")
+	assert.NoError(t, err)
+
+	reservation, err := svc.reserveTokens(ctx, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, svc.availableTokens(ctx))
+	assert.InDelta(t, 8, githubRateLimiter.Tokens(), 0.01)
+
+	// the share of the key is consumed, the Github rate limiter is left untouched
+	_, err = svc.reserveTokens(ctx, 2)
+	assert.EqualError(t, err, "CLIENT_QUOTA_REACHED")
+	assert.InDelta(t, 8, githubRateLimiter.Tokens(), 0.01)
+
+	// requests without key only use the Github rate limiter
+	assert.NoError(t, svc.allowTokens(context.Background(), 2))
+	assert.InDelta(t, 6, githubRateLimiter.Tokens(), 0.01)
+
+	// unused tokens are given back to both limiters
+	reservation.giveBack(1)
+	assert.InDelta(t, 7, githubRateLimiter.Tokens(), 0.01)
+	assert.Equal(t, 2, svc.availableTokens(ctx))
+
+	usages, err := auth.ListKeys()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), usages[0].GithubRequests)
+}
+
+// TestEvictIdleTokens checks that token subjects unused for too long are forgotten, while API keys are kept
+func TestEvictIdleTokens(t *testing.T) {
+	svc := NewAuthService(*config.GetDefault(), storage.NewNoopStorage()).(authService)
+
+	now := time.Now()
+	idle := now.Add(-tokenClientIdleTimeout - time.Minute).UnixNano()
+
+	svc.client("jwt:idle", 10).lastUsedAt.Store(idle)
+	svc.client("jwt:active", 10).lastUsedAt.Store(now.UnixNano())
+	svc.client("api_key:ci", 10).lastUsedAt.Store(idle)
+
+	// idle subjects are only looked for once a minute
+	svc.client("jwt:new", 10)
+	assert.Len(t, svc.clients.clients, 4)
+
+	svc.clients.evictIdleTokens(now.Add(2 * time.Minute))
+	assert.Len(t, svc.clients.clients, 3)
+	assert.NotContains(t, svc.clients.clients, "jwt:idle")
+	assert.Contains(t, svc.clients.clients, "api_key:ci")
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Default quota of the core bucket, used until the real one is loaded from Github
+const (
+	DefaultUnauthenticatedLimit = 60
+	DefaultAuthenticatedLimit   = 5000
+)
+
+// rateLimiterBootstrap keeps whether the local rate limiter has been synchronized with the quota reported by Github
+type rateLimiterBootstrap struct {
+	done atomic.Bool
+}
+
+// BootstrapRateLimiter loads the current quota from Github and synchronizes the local rate limiter with it,
+// so requests made by other clients with the same token are taken into account.
+// Until it succeeds, the limiter keeps its default quota and the service is reported as not ready.
+// Attempts are retried with the backoff of calls to Github, until success or the context is done
+func (s githubService) BootstrapRateLimiter(ctx context.Context) {
+	for attempt := 1; ; attempt++ {
+		buckets, err := s.GithubQuota(ctx)
+
+		if core, found := buckets["core"]; err == nil && found {
+			// tokens are never added by SetBurst, with a quota higher than the default one
+			// the limiter stays below the real quota until it's refilled
+			s.githubRateLimiter.SetBurst(core.Limit)
+
+			// tokens consumed outside of this service, or by requests made before the bootstrap
+			consumed := int(s.githubRateLimiter.Tokens()) - core.Remaining
+			if consumed > 0 {
+				s.githubRateLimiter.AllowN(time.Now(), consumed)
+			}
+
+			s.lanes.resize(core.Limit, consumed)
+
+			s.bootstrap.done.Store(true)
+
+			log.WithFields(log.Fields{
+				"totalAvailable":    core.Limit,
+				"remainingRequests": core.Remaining,
+			}).Info("local rate limiter synchronized with github rate limits")
+
+			return
+		}
+
+		delay := s.backoff(attempt)
+		log.WithError(err).WithField("delay", delay).Warning("unable to load current github rate limits. will retry")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// RateLimiterReady returns true once the local rate limiter has been synchronized with Github
+func (s githubService) RateLimiterReady() bool {
+	return s.bootstrap.done.Load()
+}
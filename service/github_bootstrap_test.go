@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	"github.com/google/go-github/v66/github"
+	githubMock "github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+// TestBootstrapRateLimiter checks that the bootstrap is retried until Github answers, then synchronizes the local rate limiter
+func TestBootstrapRateLimiter(t *testing.T) {
+	var calls atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		_, _ = w.Write(githubMock.MustMarshal(map[string]interface{}{
+			"resources": map[string]interface{}{
+				"core": github.Rate{Limit: 5000, Remaining: 4990},
+			},
+		}))
+	}))
+
+	defer server.Close()
+
+	githubClient := github.NewClient(server.Client())
+	githubClient.BaseURL, _ = url.Parse(server.URL + "/")
+
+	conf := config.GetDefault()
+	conf.Github.InitialBackoff = 1
+	conf.Github.MaxBackoff = 10
+
+	rateLimiter := rate.NewLimiter(rate.Every(time.Hour), DefaultAuthenticatedLimit)
+	githubService := NewGithubService(*conf, githubClient, rateLimiter, storage.NewNoopStorage())
+
+	assert.False(t, githubService.RateLimiterReady())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	githubService.BootstrapRateLimiter(ctx)
+
+	assert.True(t, githubService.RateLimiterReady())
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, 5000, rateLimiter.Burst())
+	assert.InDelta(t, 4990, rateLimiter.Tokens(), 1)
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// States of the circuit breaker
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// errCircuitOpen is returned by the transport instead of calling Github while the circuit is open
+var errCircuitOpen = errors.New("circuit breaker open")
+
+// circuitBreaker stops calling Github when too many of the last calls failed or were too slow.
+// Once open, all calls are rejected during the configured duration, then a single call is allowed (half-open):
+// the circuit is closed again if it succeeds, otherwise it's opened for another period
+type circuitBreaker struct {
+	mu       sync.Mutex
+	state    string
+	outcomes []bool // last calls, true when failed
+	next     int
+	count    int
+	openedAt time.Time
+	probing  bool
+	config   config.BreakerConfig
+}
+
+func newCircuitBreaker(config config.BreakerConfig) *circuitBreaker {
+	return &circuitBreaker{
+		state:    CircuitClosed,
+		outcomes: make([]bool, max(config.WindowSize, 1)),
+		config:   config,
+	}
+}
+
+// State returns the current state, an open circuit is reported as half-open once its duration is elapsed
+func (b *circuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitOpen && b.openDurationElapsed(time.Now()) {
+		return CircuitHalfOpen
+	}
+
+	return b.state
+}
+
+// rejects returns true if calls are currently rejected, without taking the half-open slot
+func (b *circuitBreaker) rejects() bool {
+	return b != nil && b.config.Enabled && b.State() == CircuitOpen
+}
+
+// allow returns true if a call can be sent. In half-open state, only one call is allowed at a time
+func (b *circuitBreaker) allow(now time.Time) bool {
+	if !b.config.Enabled {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitOpen {
+		if !b.openDurationElapsed(now) {
+			return false
+		}
+
+		b.state = CircuitHalfOpen
+		b.probing = false
+		log.Info("circuit breaker half-open. a single call is allowed to test github")
+	}
+
+	if b.state == CircuitHalfOpen {
+		if b.probing {
+			return false
+		}
+
+		b.probing = true
+	}
+
+	return true
+}
+
+// record registers the outcome of a call allowed by allow. Calls cancelled by the caller are not counted,
+// but release the half-open slot
+func (b *circuitBreaker) record(now time.Time, failed bool, counted bool) {
+	if !b.config.Enabled {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitHalfOpen:
+		b.probing = false
+
+		if !counted {
+			return
+		}
+
+		if failed {
+			b.open(now)
+		} else {
+			b.close()
+		}
+
+	case CircuitClosed:
+		if !counted {
+			return
+		}
+
+		b.outcomes[b.next] = failed
+		b.next = (b.next + 1) % len(b.outcomes)
+		b.count = min(b.count+1, len(b.outcomes))
+
+		failures := 0
+		for _, f := range b.outcomes[:b.count] {
+			if f {
+				failures += 1
+			}
+		}
+
+		if b.count >= b.config.MinimumCalls && failures*100 >= b.config.FailureRate*b.count {
+			b.open(now)
+		}
+	}
+}
+
+func (b *circuitBreaker) open(now time.Time) {
+	b.state = CircuitOpen
+	b.openedAt = now
+
+	log.WithField("openDuration", b.config.OpenDuration).Warning("circuit breaker open. calls to github are stopped")
+}
+
+func (b *circuitBreaker) close() {
+	b.state = CircuitClosed
+	b.next = 0
+	b.count = 0
+
+	log.Info("circuit breaker closed. calls to github are restored")
+}
+
+// retryAfter returns the delay until a call is allowed again, 0 if the circuit is not open
+func (b *circuitBreaker) retryAfter(now time.Time) time.Duration {
+	if b == nil || !b.config.Enabled {
+		return 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != CircuitOpen {
+		return 0
+	}
+
+	return max(b.openedAt.Add(time.Duration(b.config.OpenDuration)*time.Second).Sub(now), 0)
+}
+
+func (b *circuitBreaker) openDurationElapsed(now time.Time) bool {
+	return now.Sub(b.openedAt) >= time.Duration(b.config.OpenDuration)*time.Second
+}
+
+// circuitBreakerTransport records the outcome of every call to Github in the circuit breaker,
+// and fails fast without calling Github while the circuit is open
+type circuitBreakerTransport struct {
+	base    http.RoundTripper
+	breaker *circuitBreaker
+}
+
+func (t circuitBreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.breaker.allow(time.Now()) {
+		return nil, errCircuitOpen
+	}
+
+	start := time.Now()
+	res, err := t.base.RoundTrip(req)
+	latency := time.Since(start)
+
+	// calls cancelled because the client went away don't say anything about Github health
+	counted := !errors.Is(req.Context().Err(), context.Canceled)
+	slow := t.breaker.config.SlowCallThreshold > 0 && latency > time.Duration(t.breaker.config.SlowCallThreshold)*time.Millisecond
+	failed := err != nil || res.StatusCode >= http.StatusInternalServerError || slow
+
+	t.breaker.record(time.Now(), failed, counted)
+
+	return res, err
+}
+
+// upstreamUnavailable returns the UPSTREAM_UNAVAILABLE error, with the delay until the circuit is half-open
+func (s githubService) upstreamUnavailable(cause error) error {
+	return model.ErrUpstreamUnavailable.Wrap(cause).WithRetryAfter(s.breaker.retryAfter(time.Now()))
+}
+
+// CircuitBreakerState returns the state of the circuit breaker around the Github client
+func (s githubService) CircuitBreakerState() string {
+	return s.breaker.State()
+}
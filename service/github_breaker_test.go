@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	"github.com/google/go-github/v66/github"
+	githubMock "github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+// TestCircuitBreaker will test transitions between closed, open and half-open states
+func TestCircuitBreaker(t *testing.T) {
+	breaker := newCircuitBreaker(config.BreakerConfig{
+		Enabled:      true,
+		WindowSize:   4,
+		MinimumCalls: 4,
+		FailureRate:  50,
+		OpenDuration: 30,
+	})
+
+	now := time.Now()
+
+	// not enough calls in the window to open the circuit
+	for _, failed := range []bool{true, false, true} {
+		assert.True(t, breaker.allow(now))
+		breaker.record(now, failed, true)
+	}
+
+	assert.Equal(t, CircuitClosed, breaker.State())
+
+	// cancelled calls are not counted
+	breaker.record(now, true, false)
+	assert.Equal(t, CircuitClosed, breaker.State())
+
+	// 2 failures out of 4 calls: open
+	breaker.record(now, false, true)
+	assert.Equal(t, CircuitOpen, breaker.state)
+	assert.False(t, breaker.allow(now.Add(10*time.Second)))
+
+	// once the duration is elapsed, a single call is allowed
+	now = now.Add(31 * time.Second)
+	assert.True(t, breaker.allow(now))
+	assert.False(t, breaker.allow(now))
+
+	// the test call failed: open for another period
+	breaker.record(now, true, true)
+	assert.Equal(t, CircuitOpen, breaker.state)
+	assert.False(t, breaker.allow(now.Add(time.Second)))
+
+	// the next test call succeeds: closed
+	now = now.Add(31 * time.Second)
+	assert.True(t, breaker.allow(now))
+	breaker.record(now, false, true)
+	assert.Equal(t, CircuitClosed, breaker.state)
+	assert.True(t, breaker.allow(now))
+}
+
+// TestFetchLastHundredRepositoriesCircuitOpen checks that requests fail fast without calling Github once the circuit
+// is open, and that the last results of the search are still available from the cache
+func TestFetchLastHundredRepositoriesCircuitOpen(t *testing.T) {
+	var calls atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) > 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		_, _ = w.Write(githubMock.MustMarshal(github.RepositoriesSearchResult{
+			Repositories: []*github.Repository{
+				{ID: github.Int64(1), FullName: github.String("owner1/repo1"), Owner: &github.User{Login: github.String("owner1")}, Name: github.String("repo1")},
+			},
+		}))
+	}))
+
+	defer server.Close()
+
+	githubClient := github.NewClient(server.Client())
+	githubClient.BaseURL, _ = url.Parse(server.URL + "/")
+
+	conf := config.GetDefault()
+	conf.Github.MaxAttempts = 2
+	conf.Github.InitialBackoff = 1
+	conf.Breaker.MinimumCalls = 2
+
+	mockedRateLimiter := rate.NewLimiter(rate.Every(time.Hour), 10)
+	svc := NewGithubService(*conf, githubClient, mockedRateLimiter, storage.NewNoopStorage())
+
+	// first search succeeds and is cached
+	repos, err := svc.FetchLastHundredRepositories(context.Background(), model.SearchQuery{Language: "Go"})
+	assert.NoError(t, err)
+	assert.Len(t, repos, 1)
+
+	// then Github fails: 1 failure out of 2 calls opens the circuit, so the call is not retried
+	tokens := mockedRateLimiter.Tokens()
+
+	_, err = svc.FetchLastHundredRepositories(context.Background(), model.SearchQuery{Language: "Go"})
+	assert.EqualError(t, err, "UPSTREAM_UNAVAILABLE")
+	assert.Equal(t, CircuitOpen, svc.CircuitBreakerState())
+	assert.Equal(t, int32(2), calls.Load())
+	assert.InDelta(t, tokens-1, mockedRateLimiter.Tokens(), 0.01)
+
+	// requests fail fast, without calling Github or consuming tokens
+	tokens = mockedRateLimiter.Tokens()
+
+	_, err = svc.FetchLastHundredRepositories(context.Background(), model.SearchQuery{Language: "go "})
+	assert.EqualError(t, err, "UPSTREAM_UNAVAILABLE")
+	assert.Equal(t, int32(2), calls.Load())
+	assert.InDelta(t, tokens, mockedRateLimiter.Tokens(), 0.01)
+
+	// equivalent search is served from the cache
+	cached, _, found := svc.CachedRepositories(model.SearchQuery{Language: "go "})
+	assert.True(t, found)
+	assert.Equal(t, repos, cached)
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"container/list"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+)
+
+// resultsCache keeps the last results of each search, to be served when Github is unavailable.
+// Expired results are dropped, and the least recently used searches are evicted once maxEntries are kept
+type resultsCache struct {
+	maxAge     time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	results map[string]*list.Element
+	// searches from the most recently used to the least recently used one
+	order *list.List
+}
+
+type cachedResults struct {
+	key          string
+	repositories []model.GithubRepository
+	fetchedAt    time.Time
+}
+
+func newResultsCache(config config.CacheConfig) *resultsCache {
+	return &resultsCache{
+		maxAge:     time.Duration(config.MaxAge) * time.Second,
+		maxEntries: config.MaxEntries,
+		results:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// put replaces the results of a search. Repositories are copied, so the caller can still modify them
+func (c *resultsCache) put(searchQuery model.SearchQuery, repositories []model.GithubRepository, fetchedAt time.Time) {
+	if c.maxAge <= 0 || c.maxEntries <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := searchQuery.Key()
+	cached := &cachedResults{key: key, repositories: slices.Clone(repositories), fetchedAt: fetchedAt}
+
+	if element, found := c.results[key]; found {
+		element.Value = cached
+		c.order.MoveToFront(element)
+	} else {
+		c.results[key] = c.order.PushFront(cached)
+	}
+
+	// the least recently used searches are the most likely to be expired
+	for element := c.order.Back(); element != nil; element = c.order.Back() {
+		if c.order.Len() <= c.maxEntries && fetchedAt.Sub(element.Value.(*cachedResults).fetchedAt) <= c.maxAge {
+			break
+		}
+
+		c.remove(element)
+	}
+}
+
+// get returns the last results of a search, if they are not older than maxAge
+func (c *resultsCache) get(searchQuery model.SearchQuery, now time.Time) ([]model.GithubRepository, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, found := c.results[searchQuery.Key()]
+	if !found {
+		return nil, time.Time{}, false
+	}
+
+	cached := element.Value.(*cachedResults)
+	if now.Sub(cached.fetchedAt) > c.maxAge {
+		c.remove(element)
+		return nil, time.Time{}, false
+	}
+
+	c.order.MoveToFront(element)
+
+	return slices.Clone(cached.repositories), cached.fetchedAt, true
+}
+
+func (c *resultsCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.results, element.Value.(*cachedResults).key)
+}
+
+// len returns the number of searches kept
+func (c *resultsCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.results)
+}
+
+// withCachedLanguages sets the languages of the repositories found in the recent results of the same search,
+// if their most used language didn't change. Returns the repositories whose languages still have to be loaded
+func (s githubService) withCachedLanguages(searchQuery model.SearchQuery, repos []model.GithubRepository) []model.GithubRepository {
+	cached, _, _ := s.CachedRepositories(searchQuery)
+
+	cachedByID := make(map[int64]model.GithubRepository, len(cached))
+	for _, r := range cached {
+		cachedByID[r.ID] = r
+	}
+
+	toLoad := make([]model.GithubRepository, 0, len(repos))
+
+	for i, r := range repos {
+		c, found := cachedByID[r.ID]
+
+		if found && c.Languages != nil && r.MostUsedLanguage != nil && c.MostUsedLanguage != nil && *c.MostUsedLanguage == *r.MostUsedLanguage {
+			repos[i].Languages = c.Languages
+			continue
+		}
+
+		toLoad = append(toLoad, r)
+	}
+
+	return toLoad
+}
+
+// CacheEntries returns the number of searches kept in the results cache
+func (s githubService) CacheEntries() int {
+	return s.cache.len()
+}
+
+// CachedRepositories returns the last results of a search, if they are recent enough to be served when Github is unavailable
+func (s githubService) CachedRepositories(searchQuery model.SearchQuery) ([]model.GithubRepository, time.Time, bool) {
+	if s.config.Cache.MaxAge <= 0 {
+		return nil, time.Time{}, false
+	}
+
+	return s.cache.get(searchQuery, time.Now())
+}
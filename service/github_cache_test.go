@@ -0,0 +1,46 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestResultsCache checks that expired results are dropped and that the least recently used searches are evicted
+func TestResultsCache(t *testing.T) {
+	cache := newResultsCache(config.CacheConfig{MaxAge: 60, MaxEntries: 2})
+
+	now := time.Now()
+	repos := []model.GithubRepository{{ID: 1, FullName: "scalingo/go"}}
+
+	cache.put(model.SearchQuery{Language: "go"}, repos, now.Add(-2*time.Minute))
+	cache.put(model.SearchQuery{Language: "ruby"}, repos, now)
+
+	// expired results are dropped by the next put
+	assert.Equal(t, 1, cache.len())
+
+	cache.put(model.SearchQuery{Language: "php"}, repos, now)
+
+	// ruby is used, so php is the least recently used search
+	_, _, found := cache.get(model.SearchQuery{Language: "ruby"}, now)
+	assert.True(t, found)
+
+	cache.put(model.SearchQuery{Language: "rust"}, repos, now)
+	assert.Equal(t, 2, cache.len())
+
+	_, _, found = cache.get(model.SearchQuery{Language: "php"}, now)
+	assert.False(t, found)
+
+	cached, fetchedAt, found := cache.get(model.SearchQuery{Language: "ruby"}, now)
+	assert.True(t, found)
+	assert.Equal(t, repos, cached)
+	assert.Equal(t, now, fetchedAt)
+
+	// expired results are dropped when read
+	_, _, found = cache.get(model.SearchQuery{Language: "rust"}, now.Add(2*time.Minute))
+	assert.False(t, found)
+	assert.Equal(t, 1, cache.len())
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/logger"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// CoalesceLastHundredRepositories works like FetchLastHundredRepositories, but concurrent calls with the same (normalized)
+// query share a single execution, so the search and the languages are only requested (and counted in the rate limit) once.
+// Returns true if the result has been shared with other callers.
+// The execution is detached from the context of the first caller, so it's not cancelled if this caller goes away;
+// each caller still stops waiting when its own context is done.
+// Only the calls of the same client in the same lane are shared, because the execution is counted in the share of the first caller
+func (s githubService) CoalesceLastHundredRepositories(ctx context.Context, seachQuery model.SearchQuery) ([]model.GithubRepository, bool, error) {
+	results := s.requests.DoChan(s.coalescingKey(ctx, seachQuery), func() (interface{}, error) {
+		executionCtx, cancel := s.executionContext(ctx)
+		defer cancel()
+
+		return s.FetchLastHundredRepositories(executionCtx, seachQuery)
+	})
+
+	select {
+	case <-ctx.Done():
+		return []model.GithubRepository{}, false, contextError(ctx.Err())
+
+	case result := <-results:
+		if result.Shared {
+			log.WithContext(ctx).WithField("query", seachQuery.Key()).Debug("result shared between concurrent identical requests")
+		}
+
+		if result.Err != nil {
+			return []model.GithubRepository{}, result.Shared, result.Err
+		}
+
+		// each caller gets its own copy, the shared result must not be modified
+		return slices.Clone(result.Val.([]model.GithubRepository)), result.Shared, nil
+	}
+}
+
+// executionContext returns a context not cancelled with the caller one, limited by the configured request timeout
+func (s githubService) executionContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := context.WithoutCancel(ctx)
+
+	if s.config.API.RequestTimeout <= 0 {
+		return context.WithCancel(detached)
+	}
+
+	return context.WithTimeout(detached, time.Duration(s.config.API.RequestTimeout)*time.Second)
+}
+
+// coalescingKey identifies the calls that can share an execution: same query, same client and same lane
+func (s githubService) coalescingKey(ctx context.Context, seachQuery model.SearchQuery) string {
+	lane := ""
+	if s.lanes != nil {
+		lane, _ = s.lanes.lane(ctx)
+	}
+
+	return logger.PrincipalFromContext(ctx) + "|" + lane + "|" + seachQuery.Key()
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/logger"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	"github.com/google/go-github/v66/github"
+	githubMock "github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+// TestCoalesceLastHundredRepositories checks that concurrent identical queries share a single search,
+// and that a caller going away doesn't cancel the execution for the others
+func TestCoalesceLastHundredRepositories(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		<-release
+
+		_, _ = w.Write(githubMock.MustMarshal(github.RepositoriesSearchResult{
+			Repositories: []*github.Repository{
+				{ID: github.Int64(1), FullName: github.String("owner1/repo1"), Owner: &github.User{Login: github.String("owner1")}, Name: github.String("repo1")},
+			},
+		}))
+	}))
+
+	defer server.Close()
+
+	githubClient := github.NewClient(server.Client())
+	githubClient.BaseURL, _ = url.Parse(server.URL + "/")
+
+	mockedRateLimiter := rate.NewLimiter(rate.Every(time.Hour), 10)
+	svc := NewGithubService(*config.GetDefault(), githubClient, mockedRateLimiter, storage.NewNoopStorage())
+
+	// the first caller goes away before the end
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error, 1)
+
+	go func() {
+		_, _, err := svc.CoalesceLastHundredRepositories(canceledCtx, model.SearchQuery{Language: "Go"})
+		canceled <- err
+	}()
+
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// other callers with an equivalent query join the running execution
+	var wg sync.WaitGroup
+	coalesced := make([]bool, 3)
+	errs := make([]error, 3)
+
+	for i, language := range []string{"Go", "go", " GO"} {
+		wg.Add(1)
+
+		go func(i int, language string) {
+			defer wg.Done()
+			_, coalesced[i], errs[i] = svc.CoalesceLastHundredRepositories(context.Background(), model.SearchQuery{Language: language})
+		}(i, language)
+	}
+
+	cancel()
+	assert.EqualError(t, <-canceled, "REQUEST_CANCELED")
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i := range errs {
+		assert.NoError(t, errs[i])
+		assert.True(t, coalesced[i])
+	}
+
+	assert.Equal(t, int32(1), calls.Load())
+	assert.InDelta(t, 9, mockedRateLimiter.Tokens(), 0.01)
+
+	// once finished, the next call is executed again
+	_, isCoalesced, err := svc.CoalesceLastHundredRepositories(context.Background(), model.SearchQuery{Language: "Go"})
+	assert.NoError(t, err)
+	assert.False(t, isCoalesced)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+// TestCoalesceLastHundredRepositoriesPerClient checks that identical queries of different clients are not shared,
+// each one is counted in the share of its own client
+func TestCoalesceLastHundredRepositoriesPerClient(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		<-release
+
+		_, _ = w.Write(githubMock.MustMarshal(github.RepositoriesSearchResult{}))
+	}))
+
+	defer server.Close()
+
+	githubClient := github.NewClient(server.Client())
+	githubClient.BaseURL, _ = url.Parse(server.URL + "/")
+
+	svc := NewGithubService(*config.GetDefault(), githubClient, rate.NewLimiter(rate.Every(time.Hour), 10), storage.NewNoopStorage())
+
+	var wg sync.WaitGroup
+	coalesced := make([]bool, 2)
+
+	for i, principal := range []string{"api-key:ci", "api-key:dashboard"} {
+		wg.Add(1)
+
+		go func(i int, principal string) {
+			defer wg.Done()
+
+			ctx := logger.ContextWithPrincipal(context.Background(), principal)
+			_, coalesced[i], _ = svc.CoalesceLastHundredRepositories(ctx, model.SearchQuery{Language: "Go"})
+		}(i, principal)
+	}
+
+	// both searches are sent while the first one is still running
+	for deadline := time.Now().Add(time.Second); calls.Load() < 2 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, []bool{false, false}, coalesced)
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// Minimum delay between two decreases, so a burst of failures from calls sent at the same time only halves the level once
+const concurrencyDecreaseCooldown = time.Second
+
+// adaptiveLimiter limits the number of concurrent calls to Github using AIMD (additive increase, multiplicative decrease).
+// The level grows by one each time a full level of calls succeeded under the target latency,
+// and is halved when Github answers with a secondary rate limit or a 5xx error
+type adaptiveLimiter struct {
+	mu             sync.Mutex
+	level          int
+	successes      int // fast calls since the last change of level
+	inFlight       int
+	changed        chan struct{} // closed and replaced each time a slot may be available
+	lastDecreaseAt time.Time
+	config         config.TasksConfig
+}
+
+func newAdaptiveLimiter(config config.TasksConfig) *adaptiveLimiter {
+	config.MinParallelTasksAllowed = max(config.MinParallelTasksAllowed, 1)
+	config.MaxParallelTasksAllowed = max(config.MaxParallelTasksAllowed, config.MinParallelTasksAllowed)
+
+	return &adaptiveLimiter{
+		level:   min(max(config.InitialParallelTasks, config.MinParallelTasksAllowed), config.MaxParallelTasksAllowed),
+		changed: make(chan struct{}),
+		config:  config,
+	}
+}
+
+// Level returns the current number of calls allowed concurrently
+func (l *adaptiveLimiter) Level() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.level
+}
+
+// acquire waits for a free slot, unless the context is done in the meantime
+func (l *adaptiveLimiter) acquire(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		l.mu.Lock()
+		if l.inFlight < l.level {
+			l.inFlight += 1
+			l.mu.Unlock()
+			return nil
+		}
+
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// release frees a slot taken with acquire
+func (l *adaptiveLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight -= 1
+	l.notify()
+}
+
+// observe adjusts the level with the outcome of a call to Github
+func (l *adaptiveLimiter) observe(now time.Time, overloaded bool, latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	previous := l.level
+
+	switch {
+	case overloaded:
+		if now.Sub(l.lastDecreaseAt) < concurrencyDecreaseCooldown {
+			return
+		}
+
+		l.lastDecreaseAt = now
+		l.successes = 0
+		l.level = max(l.level/2, l.config.MinParallelTasksAllowed)
+
+	case latency <= time.Duration(l.config.TargetLatency)*time.Millisecond:
+		l.successes += 1
+		if l.successes >= l.level {
+			l.successes = 0
+			l.level = min(l.level+1, l.config.MaxParallelTasksAllowed)
+		}
+	}
+
+	if l.level != previous {
+		log.WithFields(log.Fields{
+			"previous": previous,
+			"level":    l.level,
+		}).Debug("languages concurrency level changed")
+
+		l.notify()
+	}
+}
+
+// notify wakes up all callers waiting for a slot. Must be called with the mutex held
+func (l *adaptiveLimiter) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// adaptiveConcurrencyTransport reports the outcome of every call to Github to the adaptive limiter
+type adaptiveConcurrencyTransport struct {
+	base    http.RoundTripper
+	limiter *adaptiveLimiter
+}
+
+func (t adaptiveConcurrencyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.base.RoundTrip(req)
+	latency := time.Since(start)
+
+	// calls not sent or cancelled by the caller don't say anything about Github load
+	if errors.Is(err, errCircuitOpen) || errors.Is(req.Context().Err(), context.Canceled) {
+		return res, err
+	}
+
+	t.limiter.observe(time.Now(), isOverloaded(res, err), latency)
+
+	return res, err
+}
+
+// isOverloaded returns true when Github asks to slow down: secondary rate limit, 5xx errors or network errors.
+// Secondary rate limits are answered with 429, or 403 with a Retry-After header (the primary one has no remaining requests)
+func isOverloaded(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch {
+	case res.StatusCode >= http.StatusInternalServerError, res.StatusCode == http.StatusTooManyRequests:
+		return true
+	case res.StatusCode == http.StatusForbidden:
+		return res.Header.Get("Retry-After") != "" && res.Header.Get("X-RateLimit-Remaining") != "0"
+	}
+
+	return false
+}
+
+// ConcurrencyLevel returns the number of languages requests currently allowed to run concurrently
+func (s githubService) ConcurrencyLevel() int {
+	return s.concurrency.Level()
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAdaptiveLimiter will test the additive increase and multiplicative decrease of the concurrency level
+func TestAdaptiveLimiter(t *testing.T) {
+	limiter := newAdaptiveLimiter(config.TasksConfig{
+		MaxParallelTasksAllowed: 6,
+		MinParallelTasksAllowed: 2,
+		InitialParallelTasks:    4,
+		TargetLatency:           100,
+	})
+
+	now := time.Now()
+	assert.Equal(t, 4, limiter.Level())
+
+	// a full level of fast calls grows the level by one
+	for i := 0; i < 4; i++ {
+		limiter.observe(now, false, 10*time.Millisecond)
+	}
+
+	assert.Equal(t, 5, limiter.Level())
+
+	// slow calls hold the level
+	for i := 0; i < 10; i++ {
+		limiter.observe(now, false, time.Second)
+	}
+
+	assert.Equal(t, 5, limiter.Level())
+
+	// never above the maximum
+	for i := 0; i < 50; i++ {
+		limiter.observe(now, false, 10*time.Millisecond)
+	}
+
+	assert.Equal(t, 6, limiter.Level())
+
+	// overload halves the level, only once for a burst of failures
+	limiter.observe(now, true, 0)
+	limiter.observe(now, true, 0)
+	assert.Equal(t, 3, limiter.Level())
+
+	// never below the minimum
+	limiter.observe(now.Add(2*time.Second), true, 0)
+	assert.Equal(t, 2, limiter.Level())
+}
+
+// TestAdaptiveLimiterAcquire checks that callers wait for a free slot, unless their context is done
+func TestAdaptiveLimiterAcquire(t *testing.T) {
+	limiter := newAdaptiveLimiter(config.TasksConfig{
+		MaxParallelTasksAllowed: 1,
+		InitialParallelTasks:    1,
+	})
+
+	assert.NoError(t, limiter.acquire(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, limiter.acquire(ctx), context.DeadlineExceeded)
+
+	acquired := make(chan error)
+
+	go func() {
+		acquired <- limiter.acquire(context.Background())
+	}()
+
+	limiter.release()
+	assert.NoError(t, <-acquired)
+}
+
+// TestIsOverloaded test function called isOverloaded
+func TestIsOverloaded(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		headers  map[string]string
+		err      error
+		expected bool
+	}{
+		{name: "success", status: http.StatusOK, expected: false},
+		{name: "not found", status: http.StatusNotFound, expected: false},
+		{name: "server error", status: http.StatusBadGateway, expected: true},
+		{name: "too many requests", status: http.StatusTooManyRequests, expected: true},
+		{name: "secondary rate limit", status: http.StatusForbidden, headers: map[string]string{"Retry-After": "60"}, expected: true},
+		{name: "primary rate limit", status: http.StatusForbidden, headers: map[string]string{"Retry-After": "60", "X-RateLimit-Remaining": "0"}, expected: false},
+		{name: "forbidden", status: http.StatusForbidden, expected: false},
+		{name: "network error", err: errors.New("connection reset"), expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res *http.Response
+
+			if tt.err == nil {
+				res = &http.Response{StatusCode: tt.status, Header: http.Header{}}
+				for key, value := range tt.headers {
+					res.Header.Set(key, value)
+				}
+			}
+
+			assert.Equal(t, tt.expected, isOverloaded(res, tt.err))
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+)
+
+// EstimateLastHundredRepositories returns the number of requests FetchLastHundredRepositories would consume for the query.
+// Only the search is executed (and counted in the quota), no languages are loaded.
+// Languages found in the recent results of the same search are not requested again, they are counted as cache hits
+func (s githubService) EstimateLastHundredRepositories(ctx context.Context, seachQuery model.SearchQuery) (model.CostEstimate, error) {
+	estimate := model.CostEstimate{
+		Cost:      map[string]int{"core": 0, "search": 0},
+		Remaining: make(map[string]int),
+	}
+
+	// With the events source, repositories are already loaded in background, a query doesn't call Github
+	if s.config.Github.Source == config.GithubSourceEvents {
+		repos, err := s.FetchRepositoriesFromEvents(seachQuery)
+		if err != nil {
+			return model.CostEstimate{}, err
+		}
+
+		estimate.Repositories = len(repos)
+		estimate.CacheHits = len(repos)
+
+		return s.withRemainingQuota(ctx, estimate), nil
+	}
+
+	// Quota low, the query would be served from the results cache without calling Github
+	if low, reset := s.QuotaLow(); low {
+		cached, _, found := s.CachedRepositories(seachQuery)
+		if !found {
+			return model.CostEstimate{}, model.ErrQuotaLow.WithRetryAfter(time.Until(reset))
+		}
+
+		estimate.CacheOnly = true
+		estimate.Repositories = len(cached)
+		estimate.RepositoriesWithLanguages = countRepositoriesWithLanguages(cached)
+		estimate.CacheHits = estimate.RepositoriesWithLanguages
+
+		return s.withRemainingQuota(ctx, estimate), nil
+	}
+
+	repos, err := s.SearchRepositories(ctx, seachQuery)
+	if err != nil {
+		return model.CostEstimate{}, err
+	}
+
+	toLoad := countRepositoriesWithLanguages(s.withCachedLanguages(seachQuery, repos))
+
+	estimate.Repositories = len(repos)
+	estimate.RepositoriesWithLanguages = countRepositoriesWithLanguages(repos)
+	estimate.CacheHits = estimate.RepositoriesWithLanguages - toLoad
+	estimate.Cost["core"] = toLoad
+	estimate.Cost["search"] = 1
+
+	return s.withRemainingQuota(ctx, estimate), nil
+}
+
+// withRemainingQuota adds the remaining quota of each bucket, and checks the cost is within it.
+// The core quota is the one of the local rate limiter (and of the API key, if any), which also counts the search
+func (s githubService) withRemainingQuota(ctx context.Context, estimate model.CostEstimate) model.CostEstimate {
+	estimate.Remaining["core"] = s.availableTokens(ctx)
+
+	if search, found := s.quota.status(time.Now())["search"]; found && time.Now().Before(search.Reset) {
+		estimate.Remaining["search"] = search.Remaining
+	}
+
+	estimate.WithinQuota = estimate.Cost["core"]+estimate.Cost["search"] <= estimate.Remaining["core"]
+
+	if remaining, found := estimate.Remaining["search"]; found && estimate.Cost["search"] > remaining {
+		estimate.WithinQuota = false
+	}
+
+	return estimate
+}
+
+// countRepositoriesWithLanguages returns the number of repositories whose languages are loaded, the other ones have no code
+func countRepositoriesWithLanguages(repos []model.GithubRepository) int {
+	count := 0
+
+	for _, r := range repos {
+		if r.MostUsedLanguage != nil {
+			count += 1
+		}
+	}
+
+	return count
+}
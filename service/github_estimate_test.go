@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	"github.com/google/go-github/v66/github"
+	githubMock "github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+// TestEstimateLastHundredRepositories checks that only the search is executed, and the cost computed from its results
+func TestEstimateLastHundredRepositories(t *testing.T) {
+	reset := time.Now().Add(time.Minute)
+
+	tests := []struct {
+		name              string
+		tokens            int
+		quotaLow          bool
+		cached            bool
+		expectedSearches  int
+		expectedEstimate  model.CostEstimate
+		expectedErrorCode string
+	}{
+		{
+			name:             "within quota",
+			tokens:           10,
+			expectedSearches: 1,
+			expectedEstimate: model.CostEstimate{
+				Repositories:              3,
+				RepositoriesWithLanguages: 2,
+				Cost:                      map[string]int{"core": 2, "search": 1},
+				Remaining:                 map[string]int{"core": 9, "search": 29},
+				WithinQuota:               true,
+			},
+		},
+		{
+			name:             "over quota",
+			tokens:           2,
+			expectedSearches: 1,
+			expectedEstimate: model.CostEstimate{
+				Repositories:              3,
+				RepositoriesWithLanguages: 2,
+				Cost:                      map[string]int{"core": 2, "search": 1},
+				Remaining:                 map[string]int{"core": 1, "search": 29},
+				WithinQuota:               false,
+			},
+		},
+		{
+			name:             "languages cached",
+			tokens:           10,
+			cached:           true,
+			expectedSearches: 1,
+			expectedEstimate: model.CostEstimate{
+				Repositories:              3,
+				RepositoriesWithLanguages: 2,
+				CacheHits:                 1,
+				Cost:                      map[string]int{"core": 1, "search": 1},
+				Remaining:                 map[string]int{"core": 9, "search": 29},
+				WithinQuota:               true,
+			},
+		},
+		{
+			name:             "served from cache",
+			tokens:           10,
+			quotaLow:         true,
+			cached:           true,
+			expectedSearches: 0,
+			expectedEstimate: model.CostEstimate{
+				Repositories:              3,
+				RepositoriesWithLanguages: 2,
+				CacheHits:                 2,
+				CacheOnly:                 true,
+				Cost:                      map[string]int{"core": 0, "search": 0},
+				Remaining:                 map[string]int{"core": 10},
+				WithinQuota:               true,
+			},
+		},
+		{
+			name:              "not cached while quota is low",
+			tokens:            10,
+			quotaLow:          true,
+			expectedSearches:  0,
+			expectedErrorCode: "QUOTA_LOW",
+		},
+	}
+
+	repos := []*github.Repository{
+		{ID: github.Int64(1), FullName: github.String("owner1/repo1"), Name: github.String("repo1"), Owner: &github.User{Login: github.String("owner1")}, Language: github.String("Go")},
+		{ID: github.Int64(2), FullName: github.String("owner2/repo2"), Name: github.String("repo2"), Owner: &github.User{Login: github.String("owner2")}, Language: github.String("C")},
+		{ID: github.Int64(3), FullName: github.String("owner3/repo3"), Name: github.String("repo3"), Owner: &github.User{Login: github.String("owner3")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			searches := 0
+
+			mockedHTTPClient := githubMock.NewMockedHTTPClient(
+				githubMock.WithRequestMatchHandler(
+					githubMock.GetSearchRepositories,
+					http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+						searches += 1
+
+						w.Header().Set("X-RateLimit-Resource", "search")
+						w.Header().Set("X-RateLimit-Limit", "30")
+						w.Header().Set("X-RateLimit-Remaining", "29")
+						w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+						_, _ = w.Write(githubMock.MustMarshal(github.RepositoriesSearchResult{Repositories: repos}))
+					}),
+				),
+				githubMock.WithRequestMatchHandler(
+					githubMock.GetReposLanguagesByOwnerByRepo,
+					http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+						t.Error("no languages should be loaded for an estimate")
+					}),
+				),
+			)
+
+			conf := config.GetDefault()
+			conf.Quota.CoreLowWaterMark = 2
+
+			svc := NewGithubService(*conf, github.NewClient(mockedHTTPClient), rate.NewLimiter(rate.Every(time.Hour), tt.tokens), storage.NewNoopStorage()).(githubService)
+
+			if tt.quotaLow {
+				svc.quota.update("core", model.QuotaBucket{Limit: 5000, Remaining: 10, Reset: time.Now().Add(time.Hour)}, time.Now())
+			}
+
+			query := model.SearchQuery{Language: "Go"}
+			if tt.cached {
+				cached := make([]model.GithubRepository, 0, len(repos))
+				for _, r := range repos {
+					repository, _ := repositoryFromGithub(r)
+					cached = append(cached, repository)
+				}
+
+				// only the languages of the first repository have been loaded
+				cached[0].Languages = map[string]int{"Go": 100}
+
+				svc.cache.put(query, cached, time.Now())
+			}
+
+			estimate, err := svc.EstimateLastHundredRepositories(context.Background(), query)
+
+			assert.Equal(t, tt.expectedSearches, searches)
+
+			if tt.expectedErrorCode != "" {
+				assert.EqualError(t, err, tt.expectedErrorCode)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedEstimate, estimate)
+		})
+	}
+}
@@ -0,0 +1,386 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/google/go-github/v66/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// Number of repositories kept from the Events API, to match the Search API behaviour
+const eventsBufferSize = 100
+
+// repositoryEventsBuffer keeps the last repositories created on Github, as received from the Events API.
+// It is shared between the polling goroutine and the API handlers, so every access is protected by a mutex.
+// Repositories kept without languages, because tokens were missing or the request failed, are pending until they're loaded
+type repositoryEventsBuffer struct {
+	mu               sync.RWMutex
+	etag             string
+	repositories     []model.GithubRepository
+	pendingLanguages map[int64]bool
+}
+
+// conditionalRequestTransport adds the If-None-Match header with the last ETag received from the Events API.
+// Conditional requests answered with 304 Not Modified are not counted by Github in the rate limit
+type conditionalRequestTransport struct {
+	base   http.RoundTripper
+	buffer *repositoryEventsBuffer
+}
+
+func (t conditionalRequestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.buffer.mu.RLock()
+	etag := t.buffer.etag
+	t.buffer.mu.RUnlock()
+
+	if etag != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// PollRepositoryEvents will poll the Github Events API until the context is cancelled.
+// The interval between two polls is the greatest value between the configured one and the X-Poll-Interval header
+func (s githubService) PollRepositoryEvents(ctx context.Context) {
+	log.WithContext(ctx).WithField("minimumInterval", s.config.Github.EventsPollInterval).Info("start polling github events to find new repositories")
+
+	for {
+		pollInterval, err := s.FetchRepositoryEvents(ctx)
+		if err != nil {
+			log.WithContext(ctx).WithError(err).Error("unable to fetch repositories from github events")
+		}
+
+		select {
+		case <-ctx.Done():
+			log.WithContext(ctx).Info("stop polling github events")
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// FetchRepositoryEvents executes a single poll of the Github Events API.
+// Repositories creation events are converted and enriched with languages before being stored in the events buffer,
+// then the languages of repositories kept without them by previous polls are loaded with the tokens available.
+// Returns the interval to wait before the next poll
+func (s githubService) FetchRepositoryEvents(ctx context.Context) (time.Duration, error) {
+	pollInterval, err := s.pollRepositoryEvents(ctx)
+	s.reloadPendingLanguages(ctx)
+
+	return pollInterval, err
+}
+
+func (s githubService) pollRepositoryEvents(ctx context.Context) (time.Duration, error) {
+	pollInterval := time.Duration(s.config.Github.EventsPollInterval) * time.Second
+
+	// Use a reservation instead of Allow, to be able to give back the token
+	// when Github answers with 304 Not Modified, because it's not counted in the rate limit
+	reservation, err := s.reserveTokens(ctx, 1)
+	if err != nil {
+		log.WithContext(ctx).Warning("the Github rate limit has been reached. Use a token or wait until the limit reset")
+		return pollInterval, err
+	}
+
+	var events []*github.Event
+
+	res, err := s.callWithRetry(ctx, func(ctx context.Context) (*github.Response, error) {
+		var res *github.Response
+		var err error
+
+		events, res, err = s.eventsClient.Activity.ListEvents(ctx, &github.ListOptions{PerPage: 100})
+		return res, err
+	})
+
+	if res != nil {
+		if v, convErr := strconv.Atoi(res.Header.Get("X-Poll-Interval")); convErr == nil && time.Duration(v)*time.Second > pollInterval {
+			pollInterval = time.Duration(v) * time.Second
+		}
+	}
+
+	if res != nil && res.StatusCode == http.StatusNotModified {
+		reservation.giveBack(1)
+		log.WithContext(ctx).Debug("no new github events since last poll")
+		return pollInterval, nil
+	}
+
+	// the token has been used by the poll
+	reservation.giveBack(0)
+
+	if err != nil {
+		return pollInterval, s.HandleRequestErrors(err)
+	}
+
+	// Keep only repositories creation events, and skip the ones already known
+	// Events are sent from the most recent to the oldest one, the order is kept
+	newRepositories := make([]model.GithubRepository, 0)
+
+	for _, e := range events {
+		repository, ok := s.repositoryFromEvent(e)
+
+		if ok && !s.eventsBuffer.contains(repository.ID) {
+			newRepositories = append(newRepositories, repository)
+		}
+	}
+
+	log.WithContext(ctx).WithField("numberOfRepositories", len(newRepositories)).Debug("new repositories found from github events")
+
+	// Load languages for all new repositories, the same way as the Search API results
+	// If the rate limiter doesn't have enough available requests, repositories are kept without languages
+	// and loaded by the next polls
+	if len(newRepositories) > 0 {
+		if reservation, err := s.reserveTokens(ctx, len(newRepositories)); err == nil {
+			var skipped int
+			newRepositories, skipped = s.GetRepositoriesLanguages(ctx, newRepositories)
+			reservation.giveBack(skipped)
+		} else {
+			log.WithContext(ctx).WithField("repositoriesToLoad", len(newRepositories)).Warning("not enought requests in rate limiter to load languages for new repositories")
+		}
+
+		setMostUsedLanguages(newRepositories)
+	}
+
+	s.eventsBuffer.push(newRepositories, res.Header.Get("ETag"))
+	s.SaveRepositories(newRepositories)
+
+	return pollInterval, nil
+}
+
+// reloadPendingLanguages loads the languages of repositories kept without them, as many as the tokens available allow
+func (s githubService) reloadPendingLanguages(ctx context.Context) {
+	pending := s.eventsBuffer.pending()
+	if len(pending) == 0 {
+		return
+	}
+
+	available := s.availableTokens(ctx)
+	if available == 0 {
+		log.WithContext(ctx).WithField("pendingRepositories", len(pending)).Debug("no request available in rate limiter to load pending languages")
+		return
+	}
+
+	pending = pending[:min(len(pending), available)]
+
+	reservation, err := s.reserveTokens(ctx, len(pending))
+	if err != nil {
+		return
+	}
+
+	pending, skipped := s.GetRepositoriesLanguages(ctx, pending)
+	reservation.giveBack(skipped)
+
+	setMostUsedLanguages(pending)
+
+	loaded := make([]model.GithubRepository, 0, len(pending))
+
+	for _, repository := range pending {
+		if repository.Languages != nil {
+			s.eventsBuffer.upsert(repository, false)
+			loaded = append(loaded, repository)
+		}
+	}
+
+	log.WithContext(ctx).WithFields(log.Fields{
+		"loaded":  len(loaded),
+		"pending": len(pending) - len(loaded),
+	}).Debug("pending languages of repositories from github events loaded")
+
+	s.SaveRepositories(loaded)
+}
+
+// setMostUsedLanguages computes the most used language of repositories with their languages loaded.
+// Other ones keep an unknown most used language, so their languages are requested again
+func setMostUsedLanguages(repositories []model.GithubRepository) {
+	for i := range repositories {
+		if repositories[i].Languages != nil {
+			repositories[i].MostUsedLanguage = mostUsedLanguage(repositories[i].Languages)
+		}
+	}
+}
+
+// repositoryFromEvent converts a repository creation event to the output format.
+// Returns false if the event is not a repository creation or contains invalid information
+func (s githubService) repositoryFromEvent(e *github.Event) (model.GithubRepository, bool) {
+	if e == nil || e.GetType() != "CreateEvent" {
+		return model.GithubRepository{}, false
+	}
+
+	payload, err := e.ParsePayload()
+	if err != nil {
+		return model.GithubRepository{}, false
+	}
+
+	createEvent, ok := payload.(*github.CreateEvent)
+	if !ok || createEvent.GetRefType() != "repository" {
+		return model.GithubRepository{}, false
+	}
+
+	// Repository name in events is the full name (owner/repository)
+	owner, name, found := strings.Cut(e.GetRepo().GetName(), "/")
+
+	if e.GetRepo().ID == nil || !found {
+		log.WithFields(log.Fields{
+			"eventID": e.GetID(),
+		}).Debug("repository found with invalid information. skipped")
+
+		return model.GithubRepository{}, false
+	}
+
+	// Events don't contain the most used language, so it can't be used to skip the ListLanguages call.
+	// Mark it as unknown to force loading, the real value is computed once languages are loaded
+	unknownLanguage := ""
+
+	return model.GithubRepository{
+		ID:               e.GetRepo().GetID(),
+		FullName:         e.GetRepo().GetName(),
+		Owner:            owner,
+		Repository:       name,
+		MostUsedLanguage: &unknownLanguage,
+	}, true
+}
+
+// FetchRepositoriesFromEvents returns the last repositories received from the Events API matching the query filters.
+// Events don't contain the repository license, so this filter can't be used with this source
+func (s githubService) FetchRepositoriesFromEvents(seachQuery model.SearchQuery) ([]model.GithubRepository, error) {
+	if seachQuery.License != "" {
+		return []model.GithubRepository{}, model.ErrFilterNotSupported
+	}
+
+	s.eventsBuffer.mu.RLock()
+	defer s.eventsBuffer.mu.RUnlock()
+
+	repositories := make([]model.GithubRepository, 0)
+
+	for _, r := range s.eventsBuffer.repositories {
+		if seachQuery.Match(r) {
+			repositories = append(repositories, r)
+		}
+	}
+
+	return repositories, nil
+}
+
+// contains checks if a repository is already stored in buffer
+func (b *repositoryEventsBuffer) contains(repositoryID int64) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, r := range b.repositories {
+		if r.ID == repositoryID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pending returns the repositories of the buffer kept without languages, the most recent first
+func (b *repositoryEventsBuffer) pending() []model.GithubRepository {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	pending := make([]model.GithubRepository, 0)
+
+	for _, r := range b.repositories {
+		if b.pendingLanguages[r.ID] {
+			pending = append(pending, r)
+		}
+	}
+
+	return pending
+}
+
+// push adds the new repositories at the beginning of the buffer and drops the oldest ones
+func (b *repositoryEventsBuffer) push(repositories []model.GithubRepository, etag string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pendingLanguages == nil {
+		b.pendingLanguages = make(map[int64]bool)
+	}
+
+	for _, r := range repositories {
+		if r.Languages == nil {
+			b.pendingLanguages[r.ID] = true
+		}
+	}
+
+	b.repositories = append(repositories, b.repositories...)
+
+	b.truncate()
+
+	b.etag = etag
+}
+
+// upsert replaces a repository already in buffer.
+// If the repository is not found, it's added at the beginning of the buffer only when addIfMissing is true
+func (b *repositoryEventsBuffer) upsert(repository model.GithubRepository, addIfMissing bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i := range b.repositories {
+		if b.repositories[i].ID == repository.ID {
+			b.repositories[i] = repository
+
+			if repository.Languages != nil {
+				delete(b.pendingLanguages, repository.ID)
+			}
+
+			return
+		}
+	}
+
+	if addIfMissing {
+		b.repositories = append([]model.GithubRepository{repository}, b.repositories...)
+
+		b.truncate()
+	}
+}
+
+// remove deletes a repository from the buffer
+func (b *repositoryEventsBuffer) remove(repositoryID int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i := range b.repositories {
+		if b.repositories[i].ID == repositoryID {
+			b.repositories = append(b.repositories[:i], b.repositories[i+1:]...)
+			delete(b.pendingLanguages, repositoryID)
+
+			return
+		}
+	}
+}
+
+// truncate drops the oldest repositories once the buffer is full, they're not pending anymore
+func (b *repositoryEventsBuffer) truncate() {
+	if len(b.repositories) <= eventsBufferSize {
+		return
+	}
+
+	for _, r := range b.repositories[eventsBufferSize:] {
+		delete(b.pendingLanguages, r.ID)
+	}
+
+	b.repositories = b.repositories[:eventsBufferSize]
+}
+
+// mostUsedLanguage returns the language with the greatest number of bytes, or nil if there is no language
+func mostUsedLanguage(languages map[string]int) *string {
+	var mostUsed *string
+
+	for language, bytes := range languages {
+		if mostUsed == nil || bytes > languages[*mostUsed] || (bytes == languages[*mostUsed] && language < *mostUsed) {
+			l := language
+			mostUsed = &l
+		}
+	}
+
+	return mostUsed
+}
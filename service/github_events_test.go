@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	"github.com/google/go-github/v66/github"
+	githubMock "github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+// newCreateEvent will create a github event for the creation of a repository or branch
+func newCreateEvent(repositoryID int64, fullName string, refType string) *github.Event {
+	payload := json.RawMessage(`{"ref_type":"` + refType + `"}`)
+
+	return &github.Event{
+		Type:       github.String("CreateEvent"),
+		RawPayload: &payload,
+		Repo: &github.Repository{
+			ID:   github.Int64(repositoryID),
+			Name: github.String(fullName),
+		},
+	}
+}
+
+// TestFetchRepositoryEvents will test function FetchRepositoryEvents
+func TestFetchRepositoryEvents(t *testing.T) {
+	events := []*github.Event{
+		newCreateEvent(1, "owner1/repo1", "repository"),
+		newCreateEvent(2, "owner2/repo2", "branch"),
+		{Type: github.String("PushEvent"), Repo: &github.Repository{ID: github.Int64(3), Name: github.String("owner3/repo3")}},
+		newCreateEvent(4, "owner4/repo4", "repository"),
+	}
+
+	mockedHTTPClient := githubMock.NewMockedHTTPClient(
+		githubMock.WithRequestMatchHandler(
+			githubMock.GetEvents,
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Poll-Interval", "120")
+
+				if r.Header.Get("If-None-Match") == `"etag-1"` {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+
+				w.Header().Set("ETag", `"etag-1"`)
+				_, err := w.Write(githubMock.MustMarshal(events))
+
+				if err != nil {
+					t.Error("unable to configure mock http client")
+				}
+			}),
+		),
+		githubMock.WithRequestMatchHandler(
+			githubMock.GetReposLanguagesByOwnerByRepo,
+			http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, err := w.Write(githubMock.MustMarshal(map[string]int{"Go": 100, "Shell": 10}))
+
+				if err != nil {
+					t.Error("unable to configure mock http client")
+				}
+			}),
+		),
+	)
+
+	mockedRateLimiter := rate.NewLimiter(rate.Every(time.Hour), 60)
+	mockedGithubClient := github.NewClient(mockedHTTPClient)
+	conf := config.GetDefault()
+	conf.Github.Source = config.GithubSourceEvents
+	svc := NewGithubService(*conf, mockedGithubClient, mockedRateLimiter, storage.NewNoopStorage())
+
+	// first poll must load the two repositories created with their languages
+	pollInterval, err := svc.FetchRepositoryEvents(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 120*time.Second, pollInterval)
+
+	repos, err := svc.FetchRepositoriesFromEvents(model.SearchQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, repos, 2)
+	assert.Equal(t, "owner1", repos[0].Owner)
+	assert.Equal(t, "repo1", repos[0].Repository)
+	assert.Equal(t, map[string]int{"Go": 100, "Shell": 10}, repos[0].Languages)
+	assert.Equal(t, github.String("Go"), repos[0].MostUsedLanguage)
+	assert.Equal(t, "owner4/repo4", repos[1].FullName)
+
+	// 3 tokens used: events and two languages
+	assert.InDelta(t, 57, mockedRateLimiter.Tokens(), 0.1)
+
+	// second poll is answered with 304, the token must be given back
+	_, err = svc.FetchRepositoryEvents(context.Background())
+	assert.NoError(t, err)
+	assert.InDelta(t, 57, mockedRateLimiter.Tokens(), 0.1)
+
+	// filters are applied locally
+	repos, err = svc.FetchRepositoriesFromEvents(model.SearchQuery{Owner: "OWNER4", Language: "go"})
+	assert.NoError(t, err)
+	assert.Len(t, repos, 1)
+	assert.Equal(t, int64(4), repos[0].ID)
+
+	// like with the Search API, the language filter only matches the most used language
+	repos, err = svc.FetchRepositoriesFromEvents(model.SearchQuery{Language: "shell"})
+	assert.NoError(t, err)
+	assert.Len(t, repos, 0)
+
+	_, err = svc.FetchRepositoriesFromEvents(model.SearchQuery{License: "mit"})
+	assert.EqualError(t, err, "FILTER_NOT_SUPPORTED")
+}
+
+// TestFetchRepositoryEventsPendingLanguages checks that repositories kept without languages, because tokens were missing,
+// are loaded by the next polls once tokens are available
+func TestFetchRepositoryEventsPendingLanguages(t *testing.T) {
+	events := []*github.Event{
+		newCreateEvent(1, "owner1/repo1", "repository"),
+		newCreateEvent(2, "owner2/repo2", "repository"),
+	}
+
+	mockedHTTPClient := githubMock.NewMockedHTTPClient(
+		githubMock.WithRequestMatchHandler(
+			githubMock.GetEvents,
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("If-None-Match") == `"etag-1"` {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+
+				w.Header().Set("ETag", `"etag-1"`)
+				_, err := w.Write(githubMock.MustMarshal(events))
+
+				if err != nil {
+					t.Error("unable to configure mock http client")
+				}
+			}),
+		),
+		githubMock.WithRequestMatchHandler(
+			githubMock.GetReposLanguagesByOwnerByRepo,
+			http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, err := w.Write(githubMock.MustMarshal(map[string]int{"Go": 100}))
+
+				if err != nil {
+					t.Error("unable to configure mock http client")
+				}
+			}),
+		),
+	)
+
+	// a single token, used by the poll itself
+	mockedRateLimiter := rate.NewLimiter(rate.Every(time.Hour), 1)
+	conf := config.GetDefault()
+	conf.Github.Source = config.GithubSourceEvents
+	svc := NewGithubService(*conf, github.NewClient(mockedHTTPClient), mockedRateLimiter, storage.NewNoopStorage())
+
+	_, err := svc.FetchRepositoryEvents(context.Background())
+	assert.NoError(t, err)
+
+	repos, err := svc.FetchRepositoriesFromEvents(model.SearchQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, repos, 2)
+	assert.Nil(t, repos[0].Languages)
+
+	repos, err = svc.FetchRepositoriesFromEvents(model.SearchQuery{Language: "go"})
+	assert.NoError(t, err)
+	assert.Len(t, repos, 0)
+
+	// tokens are available again, the next poll (not modified) loads the pending languages
+	mockedRateLimiter.SetLimit(rate.Inf)
+	mockedRateLimiter.SetBurst(10)
+
+	_, err = svc.FetchRepositoryEvents(context.Background())
+	assert.NoError(t, err)
+
+	repos, err = svc.FetchRepositoriesFromEvents(model.SearchQuery{Language: "go"})
+	assert.NoError(t, err)
+	assert.Len(t, repos, 2)
+	assert.Equal(t, map[string]int{"Go": 100}, repos[0].Languages)
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/google/go-github/v66/github"
+)
+
+// GithubQuota loads the current quota of each Github bucket (core, search).
+// This endpoint is not counted in the rate limit, so it's also used to check that Github is reachable
+func (s githubService) GithubQuota(ctx context.Context) (map[string]model.QuotaBucket, error) {
+	ctx, cancel := s.upstreamContext(ctx)
+	defer cancel()
+
+	limits, _, err := s.githubClient.RateLimit.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make(map[string]model.QuotaBucket)
+	now := time.Now()
+
+	for name, rate := range map[string]*github.Rate{"core": limits.GetCore(), "search": limits.GetSearch()} {
+		if rate != nil {
+			buckets[name] = model.QuotaBucket{Limit: rate.Limit, Remaining: rate.Remaining, Reset: rate.Reset.Time}
+			s.quota.update(name, buckets[name], now)
+		}
+	}
+
+	return buckets, nil
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetRepositoryHistory returns the timeline of languages changes for a repository.
+// Snapshots are taken from the storage, each time languages are fetched from Github, so no request is made here
+func (s githubService) GetRepositoryHistory(owner string, name string) (model.RepositoryHistory, error) {
+	if !s.config.Storage.Enabled {
+		return model.RepositoryHistory{}, model.ErrStorageDisabled
+	}
+
+	fullName := owner + "/" + name
+
+	repository, err := s.storage.GetRepository(fullName)
+	if err != nil {
+		return model.RepositoryHistory{}, s.handleStorageErrors(err, fullName)
+	}
+
+	snapshots, err := s.storage.GetLanguagesSnapshots(fullName)
+	if err != nil {
+		return model.RepositoryHistory{}, s.handleStorageErrors(err, fullName)
+	}
+
+	return model.NewRepositoryHistory(repository, snapshots), nil
+}
+
+// handleStorageErrors converts errors returned by the storage to API errors
+func (s githubService) handleStorageErrors(err error, fullName string) error {
+	if errors.Is(err, storage.ErrRepositoryNotFound) {
+		return model.ErrRepositoryNotFound.Wrap(err)
+	}
+
+	log.WithError(err).WithField("fullName", fullName).Error("unable to read repository from storage")
+	return model.ErrStorage.Wrap(err)
+}
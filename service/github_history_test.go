@@ -0,0 +1,67 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	"github.com/google/go-github/v66/github"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+// TestGetRepositoryHistory test the function called GetRepositoryHistory
+func TestGetRepositoryHistory(t *testing.T) {
+	conf := config.GetDefault()
+	conf.Storage.Path = filepath.Join(t.TempDir(), "storage.db")
+
+	store, err := storage.NewBoltStorage(conf.Storage)
+	if err != nil {
+		t.Fatalf("unable to open storage: %v", err)
+	}
+
+	defer store.Close()
+
+	mockedRateLimiter := rate.NewLimiter(rate.Every(time.Hour), 60)
+	svc := NewGithubService(*conf, github.NewClient(nil), mockedRateLimiter, store)
+
+	firstFetch := time.Date(2024, 10, 1, 10, 0, 0, 0, time.UTC)
+	secondFetch := firstFetch.Add(24 * time.Hour)
+
+	repo := model.GithubRepository{ID: 1, FullName: "owner1/repo1", Owner: "owner1", Repository: "repo1"}
+
+	repo.Languages = map[string]int{"Go": 100, "Shell": 20}
+	assert.NoError(t, store.SaveRepositories([]model.GithubRepository{repo}, firstFetch))
+
+	repo.Languages = map[string]int{"Go": 150, "Dockerfile": 5}
+	assert.NoError(t, store.SaveRepositories([]model.GithubRepository{repo}, secondFetch))
+
+	history, err := svc.GetRepositoryHistory("owner1", "repo1")
+	assert.NoError(t, err)
+	assert.Equal(t, "owner1/repo1", history.FullName)
+	assert.Equal(t, map[string]int{"Go": 150, "Dockerfile": 5}, history.Languages)
+	assert.Len(t, history.History, 2)
+
+	assert.True(t, history.History[0].FetchedAt.Equal(firstFetch))
+	assert.Equal(t, []string{"Go", "Shell"}, history.History[0].Added)
+	assert.Equal(t, []string{}, history.History[0].Removed)
+	assert.Equal(t, map[string]int{"Go": 100, "Shell": 20}, history.History[0].Deltas)
+
+	assert.True(t, history.History[1].FetchedAt.Equal(secondFetch))
+	assert.Equal(t, []string{"Dockerfile"}, history.History[1].Added)
+	assert.Equal(t, []string{"Shell"}, history.History[1].Removed)
+	assert.Equal(t, map[string]int{"Go": 50, "Dockerfile": 5, "Shell": -20}, history.History[1].Deltas)
+
+	_, err = svc.GetRepositoryHistory("unknown", "repo")
+	assert.EqualError(t, err, "REPOSITORY_NOT_FOUND")
+
+	// storage disabled
+	conf.Storage.Enabled = false
+	svc = NewGithubService(*conf, github.NewClient(nil), mockedRateLimiter, storage.NewNoopStorage())
+
+	_, err = svc.GetRepositoryHistory("owner1", "repo1")
+	assert.EqualError(t, err, "STORAGE_DISABLED")
+}
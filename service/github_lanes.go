@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// priorityLanes splits the budget of the Github rate limiter between lanes, each one guaranteed a share of it.
+// Tokens are taken from the lane of the request, in front of the Github rate limiter. When its share is consumed,
+// a lane borrows the unused tokens of the lane having the most of them, above the reserve this lane keeps for itself
+type priorityLanes struct {
+	lanes         map[string]*priorityLane
+	names         []string
+	defaultLane   string
+	lenderReserve float64
+}
+
+type priorityLane struct {
+	share   float64
+	limiter *rate.Limiter
+}
+
+type laneContextKey struct{}
+
+// newPriorityLanes creates the lanes with their share of the Github rate limiter, nil if lanes are disabled
+func newPriorityLanes(config config.LanesConfig, githubRateLimiter *rate.Limiter) *priorityLanes {
+	if !config.Enabled {
+		return nil
+	}
+
+	lanes := &priorityLanes{
+		lanes:         make(map[string]*priorityLane, len(config.Lanes)),
+		defaultLane:   config.Default,
+		lenderReserve: float64(config.LenderReserve) / 100,
+	}
+
+	for _, lane := range config.Lanes {
+		share := float64(lane.Share) / 100
+
+		lanes.names = append(lanes.names, lane.Name)
+		lanes.lanes[lane.Name] = &priorityLane{
+			share:   share,
+			limiter: rate.NewLimiter(githubRateLimiter.Limit()*rate.Limit(share), int(float64(githubRateLimiter.Burst())*share)),
+		}
+	}
+
+	return lanes
+}
+
+// lane returns the lane of the request, the default one if none has been chosen
+func (l *priorityLanes) lane(ctx context.Context) (string, *priorityLane) {
+	name, _ := ctx.Value(laneContextKey{}).(string)
+	if name == "" {
+		name = l.defaultLane
+	}
+
+	return name, l.lanes[name]
+}
+
+// limiter returns the limiter to take n tokens from: the one of the lane of the request if it has enough tokens,
+// otherwise the one of the lane lending the most tokens. Returns the limiter of the lane of the request
+// if no lane can lend them, so the reservation fails with the delay until the lane has enough tokens again
+func (l *priorityLanes) limiter(ctx context.Context, n int, at time.Time) *rate.Limiter {
+	if l == nil {
+		return nil
+	}
+
+	name, own := l.lane(ctx)
+	if own == nil {
+		return nil
+	}
+
+	if own.limiter.TokensAt(at) >= float64(n) {
+		return own.limiter
+	}
+
+	var lender string
+	lendable := float64(n)
+
+	for _, other := range l.names {
+		if other == name {
+			continue
+		}
+
+		if tokens := l.lendable(l.lanes[other], at); tokens >= lendable {
+			lender = other
+			lendable = tokens
+		}
+	}
+
+	if lender == "" {
+		return own.limiter
+	}
+
+	log.WithContext(ctx).WithFields(log.Fields{
+		"lane":   name,
+		"lender": lender,
+		"tokens": n,
+	}).Debug("lane borrowing unused tokens of another lane")
+
+	return l.lanes[lender].limiter
+}
+
+// lendable returns the tokens of a lane above the reserve it keeps for itself
+func (l *priorityLanes) lendable(lane *priorityLane, at time.Time) float64 {
+	return lane.limiter.TokensAt(at) - l.lenderReserve*float64(lane.limiter.Burst())
+}
+
+// available returns the tokens the lane of the request can use now, its own ones or the ones it can borrow
+func (l *priorityLanes) available(ctx context.Context) (int, bool) {
+	if l == nil {
+		return 0, false
+	}
+
+	name, own := l.lane(ctx)
+	if own == nil {
+		return 0, false
+	}
+
+	now := time.Now()
+	available := own.limiter.TokensAt(now)
+
+	for _, other := range l.names {
+		if other != name {
+			available = max(available, l.lendable(l.lanes[other], now))
+		}
+	}
+
+	return int(available), true
+}
+
+// resize gives each lane its share of the quota of the Github rate limiter once synchronized with Github.
+// Requests consumed outside of this service are taken from each lane according to its share
+func (l *priorityLanes) resize(burst int, consumed int) {
+	if l == nil {
+		return
+	}
+
+	now := time.Now()
+
+	for _, lane := range l.lanes {
+		lane.limiter.SetBurstAt(now, int(float64(burst)*lane.share))
+
+		if consumed > 0 {
+			lane.limiter.AllowN(now, int(float64(consumed)*lane.share))
+		}
+	}
+}
+
+// status returns the tokens remaining in each lane
+func (l *priorityLanes) status() map[string]model.RateLimitState {
+	if l == nil {
+		return nil
+	}
+
+	now := time.Now()
+	status := make(map[string]model.RateLimitState, len(l.lanes))
+
+	for name, lane := range l.lanes {
+		status[name] = model.RateLimitState{
+			Limit:     lane.limiter.Burst(),
+			Remaining: int(lane.limiter.TokensAt(now)),
+		}
+	}
+
+	return status
+}
+
+// WithLane returns a copy of the context in which tokens are taken from the lane.
+// Returns UNKNOWN_LANE if the lane is not declared, lanes are ignored when disabled
+func (s githubService) WithLane(ctx context.Context, lane string) (context.Context, error) {
+	if s.lanes == nil || lane == "" {
+		return ctx, nil
+	}
+
+	if _, found := s.lanes.lanes[lane]; !found {
+		return ctx, model.ErrUnknownLane
+	}
+
+	return context.WithValue(ctx, laneContextKey{}, lane), nil
+}
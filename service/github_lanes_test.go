@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	"github.com/google/go-github/v66/github"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+// TestPriorityLanes checks that each lane uses its share of the Github rate limiter first,
+// then borrows the unused tokens of the other lane above its reserve
+func TestPriorityLanes(t *testing.T) {
+	conf := config.GetDefault()
+	conf.Lanes.Enabled = true
+
+	githubRateLimiter := rate.NewLimiter(rate.Every(time.Hour), 100)
+	svc := NewGithubService(*conf, github.NewClient(nil), githubRateLimiter, storage.NewNoopStorage()).(githubService)
+
+	batch, err := svc.WithLane(context.Background(), "batch")
+	assert.NoError(t, err)
+
+	interactive, err := svc.WithLane(context.Background(), "interactive")
+	assert.NoError(t, err)
+
+	_, err = svc.WithLane(context.Background(), "unknown")
+	assert.EqualError(t, err, "UNKNOWN_LANE")
+
+	lanes := func() (int, int) {
+		status := svc.lanes.status()
+		return status["interactive"].Remaining, status["batch"].Remaining
+	}
+
+	tests := []struct {
+		name                string
+		ctx                 context.Context
+		tokens              int
+		expectedError       string
+		expectedInteractive int
+		expectedBatch       int
+	}{
+		{name: "batch uses its share", ctx: batch, tokens: 30, expectedInteractive: 70, expectedBatch: 0},
+		{name: "batch borrows from interactive", ctx: batch, tokens: 40, expectedInteractive: 30, expectedBatch: 0},
+		// 14 tokens (20% of the share of interactive) are never lent
+		{name: "batch can't borrow the reserve of interactive", ctx: batch, tokens: 20, expectedError: "RATE_LIMIT_REACHED", expectedInteractive: 30, expectedBatch: 0},
+		{name: "interactive uses the rest of its share", ctx: interactive, tokens: 30, expectedInteractive: 0, expectedBatch: 0},
+		{name: "requests without lane use the default one", ctx: context.Background(), tokens: 1, expectedError: "RATE_LIMIT_REACHED", expectedInteractive: 0, expectedBatch: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := svc.allowTokens(tt.ctx, tt.tokens)
+
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			interactiveRemaining, batchRemaining := lanes()
+			assert.Equal(t, tt.expectedInteractive, interactiveRemaining)
+			assert.Equal(t, tt.expectedBatch, batchRemaining)
+		})
+	}
+
+	assert.InDelta(t, 0, githubRateLimiter.Tokens(), 0.01)
+}
+
+// TestPriorityLanesGiveBack checks that unused tokens are given back to the lane they were borrowed from
+func TestPriorityLanesGiveBack(t *testing.T) {
+	conf := config.GetDefault()
+	conf.Lanes.Enabled = true
+
+	githubRateLimiter := rate.NewLimiter(rate.Every(time.Hour), 100)
+	svc := NewGithubService(*conf, github.NewClient(nil), githubRateLimiter, storage.NewNoopStorage()).(githubService)
+
+	batch, err := svc.WithLane(context.Background(), "batch")
+	assert.NoError(t, err)
+
+	assert.NoError(t, svc.allowTokens(batch, 30))
+	assert.Equal(t, 56, svc.availableTokens(batch))
+
+	reservation, err := svc.reserveTokens(batch, 50)
+	assert.NoError(t, err)
+	assert.Equal(t, 20, svc.lanes.status()["interactive"].Remaining)
+
+	reservation.giveBack(50)
+	assert.Equal(t, 70, svc.lanes.status()["interactive"].Remaining)
+	assert.InDelta(t, 70, githubRateLimiter.Tokens(), 0.01)
+
+	assert.Equal(t, map[string]model.RateLimitState{
+		"interactive": {Limit: 70, Remaining: 70},
+		"batch":       {Limit: 30, Remaining: 0},
+	}, svc.QuotaStatus().Lanes)
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Scalingo/sclng-backend-test-v1/metrics"
+)
+
+// metricsTransport counts every call to Github by endpoint and outcome,
+// and keeps the remaining quota sent by Github in the response headers
+type metricsTransport struct {
+	base http.RoundTripper
+}
+
+func (t metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.base.RoundTrip(req)
+
+	metrics.GithubCalls.WithLabelValues(githubEndpoint(req.URL.Path), githubCallOutcome(req, res, err)).Inc()
+
+	if err == nil {
+		resource := res.Header.Get("X-RateLimit-Resource")
+		remaining, convErr := strconv.Atoi(res.Header.Get("X-RateLimit-Remaining"))
+
+		// only known buckets are kept, so the number of series stays bounded
+		if convErr == nil && (resource == "core" || resource == "search") {
+			metrics.GithubRateLimitRemaining.WithLabelValues(resource).Set(float64(remaining))
+		}
+	}
+
+	return res, err
+}
+
+// githubEndpoint returns the name of the endpoint called, paths are not used as label because they contain repositories names
+func githubEndpoint(path string) string {
+	switch {
+	case strings.HasSuffix(path, "/search/repositories"):
+		return "search"
+	case strings.HasSuffix(path, "/languages"):
+		return "languages"
+	case strings.HasSuffix(path, "/events"):
+		return "events"
+	case strings.HasSuffix(path, "/rate_limit"):
+		return "rate_limit"
+	}
+
+	return "other"
+}
+
+// githubCallOutcome classifies the result of a call to Github
+func githubCallOutcome(req *http.Request, res *http.Response, err error) string {
+	if err != nil {
+		switch {
+		case errors.Is(err, errCircuitOpen):
+			return "circuit_open"
+		case errors.Is(req.Context().Err(), context.Canceled):
+			return "canceled"
+		case errors.Is(req.Context().Err(), context.DeadlineExceeded):
+			return "timeout"
+		}
+
+		return "network_error"
+	}
+
+	switch {
+	case res.StatusCode == http.StatusNotModified:
+		return "not_modified"
+	case res.StatusCode < http.StatusBadRequest:
+		return "success"
+	case (res.StatusCode == http.StatusForbidden || res.StatusCode == http.StatusTooManyRequests) && res.Header.Get("X-RateLimit-Remaining") == "0":
+		return "rate_limited"
+	case isOverloaded(res, nil) && res.StatusCode < http.StatusInternalServerError:
+		return "secondary_rate_limited"
+	case res.StatusCode < http.StatusInternalServerError:
+		return "client_error"
+	}
+
+	return "server_error"
+}
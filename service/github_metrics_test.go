@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Scalingo/sclng-backend-test-v1/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestGithubCallOutcome test function called githubCallOutcome
+func TestGithubCallOutcome(t *testing.T) {
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		status   int
+		headers  map[string]string
+		err      error
+		expected string
+	}{
+		{name: "success", status: http.StatusOK, expected: "success"},
+		{name: "not modified", status: http.StatusNotModified, expected: "not_modified"},
+		{name: "primary rate limit", status: http.StatusForbidden, headers: map[string]string{"X-RateLimit-Remaining": "0"}, expected: "rate_limited"},
+		{name: "secondary rate limit", status: http.StatusForbidden, headers: map[string]string{"Retry-After": "60"}, expected: "secondary_rate_limited"},
+		{name: "not found", status: http.StatusNotFound, expected: "client_error"},
+		{name: "server error", status: http.StatusBadGateway, expected: "server_error"},
+		{name: "circuit open", err: errCircuitOpen, expected: "circuit_open"},
+		{name: "canceled", ctx: canceledCtx, err: context.Canceled, expected: "canceled"},
+		{name: "network error", err: errors.New("connection reset"), expected: "network_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/search/repositories", nil).WithContext(ctx)
+
+			var res *http.Response
+			if tt.err == nil {
+				res = &http.Response{StatusCode: tt.status, Header: http.Header{}}
+				for key, value := range tt.headers {
+					res.Header.Set(key, value)
+				}
+			}
+
+			assert.Equal(t, tt.expected, githubCallOutcome(req, res, tt.err))
+		})
+	}
+}
+
+// TestMetricsTransport checks that calls are counted by endpoint, and the remaining quota kept by resource
+func TestMetricsTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-RateLimit-Resource", "search")
+		w.Header().Set("X-RateLimit-Remaining", "27")
+	}))
+
+	defer server.Close()
+
+	client := &http.Client{Transport: metricsTransport{base: http.DefaultTransport}}
+	calls := testutil.ToFloat64(metrics.GithubCalls.WithLabelValues("languages", "success"))
+
+	res, err := client.Get(server.URL + "/repos/owner1/repo1/languages")
+	assert.NoError(t, err)
+	res.Body.Close()
+
+	assert.Equal(t, calls+1, testutil.ToFloat64(metrics.GithubCalls.WithLabelValues("languages", "success")))
+	assert.Equal(t, float64(27), testutil.ToFloat64(metrics.GithubRateLimitRemaining.WithLabelValues("search")))
+}
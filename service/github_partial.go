@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// FetchLastHundredRepositoriesPartial works like FetchLastHundredRepositories, but instead of failing when the rate limiter
+// doesn't have enough requests for all repositories, languages are loaded for as many repositories as the budget allows.
+// Each repository is marked with its languages status, and a summary counts them
+func (s githubService) FetchLastHundredRepositoriesPartial(ctx context.Context, seachQuery model.SearchQuery) (model.PartialRepositories, error) {
+	var repos []model.GithubRepository
+	var errors []model.RepositoryError
+	var err error
+
+	// With the events source, languages are already loaded (or not) in background
+	if s.config.Github.Source == config.GithubSourceEvents {
+		repos, err = s.FetchRepositoriesFromEvents(seachQuery)
+		if err != nil {
+			return model.PartialRepositories{}, err
+		}
+
+		for i := range repos {
+			repos[i].LanguagesStatus = languagesStatusFromEvents(repos[i])
+		}
+	} else {
+		repos, err = s.SearchRepositories(ctx, seachQuery)
+		if err != nil {
+			return model.PartialRepositories{}, err
+		}
+
+		errors = s.loadLanguagesWithinBudget(ctx, repos)
+		s.SaveRepositories(repos)
+	}
+
+	return model.PartialRepositories{
+		Repositories: repos,
+		Summary:      newPartialSummary(repos, errors, s.RateLimitState()),
+	}, nil
+}
+
+// loadLanguagesWithinBudget consumes as many tokens as possible from the rate limiter, up to the number of repositories
+// with languages to load, then loads languages of the first repositories only (most recent first).
+// Statuses are set on repositories, and errors returned for the summary
+func (s githubService) loadLanguagesWithinBudget(ctx context.Context, repos []model.GithubRepository) []model.RepositoryError {
+	errors := make([]model.RepositoryError, 0)
+
+	reposWithLanguagesToLoad := countRepositoriesWithLanguages(repos)
+
+	// Tokens available can change between the check and the reservation, so the reservation is retried with less tokens
+	budget := min(reposWithLanguagesToLoad, s.availableTokens(ctx))
+	reservation, err := s.reserveTokens(ctx, budget)
+
+	for budget > 0 && err != nil {
+		budget -= 1
+		reservation, err = s.reserveTokens(ctx, budget)
+	}
+
+	log.WithContext(ctx).WithFields(log.Fields{
+		"repositoriesToLoad": reposWithLanguagesToLoad,
+		"budget":             budget,
+	}).Debug("will load languages for repositories within the rate limiter budget")
+
+	toLoad := make([]model.GithubRepository, 0, budget)
+	positions := make(map[int64]int, len(repos))
+
+	for i := range repos {
+		switch {
+		case repos[i].MostUsedLanguage == nil:
+			repos[i].Languages = map[string]int{}
+			repos[i].LanguagesStatus = model.LanguagesStatusNone
+		case len(toLoad) < budget:
+			toLoad = append(toLoad, repos[i])
+			positions[repos[i].ID] = i
+		default:
+			repos[i].LanguagesStatus = model.LanguagesStatusSkippedRateLimit
+		}
+	}
+
+	skipped := 0
+
+	for result := range s.LoadRepositoriesLanguages(ctx, toLoad) {
+		i := positions[result.RepositoryID]
+
+		if result.Skipped {
+			skipped += 1
+		}
+
+		if result.Error != nil {
+			repos[i].LanguagesStatus = model.LanguagesStatusError
+			errors = append(errors, model.RepositoryError{FullName: repos[i].FullName, Code: result.Error.Error()})
+		} else {
+			repos[i].Languages = result.Languages
+			repos[i].LanguagesStatus = model.LanguagesStatusLoaded
+		}
+	}
+
+	reservation.giveBack(skipped)
+
+	return errors
+}
+
+// languagesStatusFromEvents deduces the languages status of a repository loaded from the events source.
+// Languages are only missing when the rate limiter didn't allow to load them
+func languagesStatusFromEvents(r model.GithubRepository) string {
+	switch {
+	case r.Languages == nil:
+		return model.LanguagesStatusSkippedRateLimit
+	case len(r.Languages) == 0:
+		return model.LanguagesStatusNone
+	}
+
+	return model.LanguagesStatusLoaded
+}
+
+// newPartialSummary counts repositories by languages status.
+// All statuses are always present, to ease reading the summary
+func newPartialSummary(repos []model.GithubRepository, errors []model.RepositoryError, rateLimit model.RateLimitState) model.PartialSummary {
+	statuses := map[string]int{
+		model.LanguagesStatusLoaded:           0,
+		model.LanguagesStatusSkippedRateLimit: 0,
+		model.LanguagesStatusError:            0,
+		model.LanguagesStatusNone:             0,
+	}
+
+	for _, r := range repos {
+		statuses[r.LanguagesStatus] += 1
+	}
+
+	if errors == nil {
+		errors = make([]model.RepositoryError, 0)
+	}
+
+	return model.PartialSummary{
+		Count:     len(repos),
+		Statuses:  statuses,
+		Errors:    errors,
+		RateLimit: rateLimit,
+	}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	"github.com/google/go-github/v66/github"
+	githubMock "github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+// TestFetchLastHundredRepositoriesPartial will test function FetchLastHundredRepositoriesPartial
+func TestFetchLastHundredRepositoriesPartial(t *testing.T) {
+	mockedHTTPClient := githubMock.NewMockedHTTPClient(
+		githubMock.WithRequestMatch(
+			githubMock.GetSearchRepositories,
+			github.RepositoriesSearchResult{
+				Repositories: []*github.Repository{
+					{ID: github.Int64(1), FullName: github.String("owner1/repo1"), Owner: &github.User{Login: github.String("owner1")}, Name: github.String("repo1"), Language: github.String("Go")},
+					{ID: github.Int64(2), FullName: github.String("owner2/repo2"), Owner: &github.User{Login: github.String("owner2")}, Name: github.String("repo2"), Language: github.String("Java")},
+					{ID: github.Int64(3), FullName: github.String("owner3/repo3"), Owner: &github.User{Login: github.String("owner3")}, Name: github.String("repo3")},
+					{ID: github.Int64(4), FullName: github.String("owner4/repo4"), Owner: &github.User{Login: github.String("owner4")}, Name: github.String("repo4"), Language: github.String("Rust")},
+				},
+			},
+		),
+		githubMock.WithRequestMatchHandler(
+			githubMock.GetReposLanguagesByOwnerByRepo,
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// languages of the second repository can't be loaded
+				if strings.Contains(r.URL.Path, "repo2") {
+					githubMock.WriteError(w, http.StatusInternalServerError, "unexpected error")
+					return
+				}
+
+				_, err := w.Write(githubMock.MustMarshal(map[string]int{"Go": 10}))
+
+				if err != nil {
+					t.Error("unable to configure mock http client")
+				}
+			}),
+		),
+	)
+
+	// 1 request for the search, 2 for languages: the last repository with languages is skipped
+	mockedRateLimiter := rate.NewLimiter(rate.Every(time.Hour), 3)
+	conf := config.GetDefault()
+	svc := NewGithubService(*conf, github.NewClient(mockedHTTPClient), mockedRateLimiter, storage.NewNoopStorage())
+
+	result, err := svc.FetchLastHundredRepositoriesPartial(context.Background(), model.SearchQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, result.Repositories, 4)
+
+	statuses := make(map[string]string)
+	for _, r := range result.Repositories {
+		statuses[r.FullName] = r.LanguagesStatus
+	}
+
+	assert.Equal(t, map[string]string{
+		"owner1/repo1": model.LanguagesStatusLoaded,
+		"owner2/repo2": model.LanguagesStatusError,
+		"owner3/repo3": model.LanguagesStatusNone,
+		"owner4/repo4": model.LanguagesStatusSkippedRateLimit,
+	}, statuses)
+
+	assert.Equal(t, map[string]int{"Go": 10}, result.Repositories[0].Languages)
+	assert.Nil(t, result.Repositories[3].Languages)
+
+	assert.Equal(t, model.PartialSummary{
+		Count: 4,
+		Statuses: map[string]int{
+			model.LanguagesStatusLoaded:           1,
+			model.LanguagesStatusSkippedRateLimit: 1,
+			model.LanguagesStatusError:            1,
+			model.LanguagesStatusNone:             1,
+		},
+		Errors:    []model.RepositoryError{{FullName: "owner2/repo2", Code: "FETCH_ERROR"}},
+		RateLimit: model.RateLimitState{Limit: 3, Remaining: 0},
+	}, result.Summary)
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// Events sent to the webhook when a Github bucket goes under its low-water mark, and when it's above it again
+const (
+	QuotaLowEvent       = "quota.low"
+	QuotaRecoveredEvent = "quota.recovered"
+)
+
+// quotaTracker keeps the last quota of each Github bucket sent in the response headers,
+// the number of calls made in the last hour, and the tokens reserved by requests still running.
+// Alerts are sent when a bucket crosses its low-water mark, in both directions
+type quotaTracker struct {
+	mu       sync.Mutex
+	buckets  map[string]*trackedBucket
+	reserved atomic.Int64
+	alerts   chan model.QuotaAlert
+	config   config.QuotaConfig
+}
+
+type trackedBucket struct {
+	model.QuotaBucket
+	low       bool
+	updatedAt time.Time
+	// calls counted by minute, indexed by minute modulo 60, so only the last hour is kept
+	calls [60]minuteCalls
+}
+
+type minuteCalls struct {
+	minute int64
+	count  int
+}
+
+func newQuotaTracker(config config.QuotaConfig) *quotaTracker {
+	return &quotaTracker{
+		buckets: make(map[string]*trackedBucket),
+		alerts:  make(chan model.QuotaAlert, 16),
+		config:  config,
+	}
+}
+
+// lowWaterMark returns the remaining requests of a bucket under which the quota is low, 0 if disabled.
+// The mark is configured as a percentage of the limit, which depends on the token used (60 requests per hour without)
+func (q *quotaTracker) lowWaterMark(name string, limit int) int {
+	switch name {
+	case "core":
+		return limit * q.config.CoreLowWaterMark / 100
+	case "search":
+		return limit * q.config.SearchLowWaterMark / 100
+	}
+
+	return 0
+}
+
+func (q *quotaTracker) bucket(name string) *trackedBucket {
+	b, found := q.buckets[name]
+	if !found {
+		b = &trackedBucket{}
+		q.buckets[name] = b
+	}
+
+	return b
+}
+
+// update keeps the quota of a bucket and sends an alert if it crossed its low-water mark
+func (q *quotaTracker) update(name string, quota model.QuotaBucket, now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	b := q.bucket(name)
+	b.QuotaBucket = quota
+	b.updatedAt = now
+
+	mark := q.lowWaterMark(name, quota.Limit)
+	low := mark > 0 && quota.Remaining < mark
+
+	if low == b.low {
+		return
+	}
+
+	b.low = low
+
+	alert := model.QuotaAlert{
+		Event:        QuotaRecoveredEvent,
+		Bucket:       name,
+		Limit:        quota.Limit,
+		Remaining:    quota.Remaining,
+		LowWaterMark: mark,
+		Reset:        quota.Reset,
+	}
+
+	if low {
+		alert.Event = QuotaLowEvent
+	}
+
+	// alerts are dropped rather than slowing down calls to Github if nobody reads them
+	select {
+	case q.alerts <- alert:
+	default:
+		log.WithField("bucket", name).Warning("quota alert dropped, too many alerts pending")
+	}
+}
+
+// consume counts a call made in a bucket
+func (q *quotaTracker) consume(name string, now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	b := q.bucket(name)
+	minute := now.Unix() / 60
+	slot := &b.calls[minute%60]
+
+	if slot.minute != minute {
+		*slot = minuteCalls{minute: minute}
+	}
+
+	slot.count++
+}
+
+// low returns true if a bucket is under its low-water mark, and the time when all of them are reset.
+// A bucket is not low anymore once its reset time is passed, even if no call has been made since
+func (q *quotaTracker) low(now time.Time) (bool, time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	low := false
+	var reset time.Time
+
+	for _, b := range q.buckets {
+		if b.low && now.Before(b.Reset) {
+			low = true
+
+			if b.Reset.After(reset) {
+				reset = b.Reset
+			}
+		}
+	}
+
+	return low, reset
+}
+
+// status returns the quota of each bucket known, the tokens reserved are only counted in the core bucket
+// because the local rate limiter is only used for it
+func (q *quotaTracker) status(now time.Time) map[string]model.QuotaBucketStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	buckets := make(map[string]model.QuotaBucketStatus, len(q.buckets))
+
+	for name, b := range q.buckets {
+		status := model.QuotaBucketStatus{
+			QuotaBucket:  b.QuotaBucket,
+			LowWaterMark: q.lowWaterMark(name, b.Limit),
+			Low:          b.low && now.Before(b.Reset),
+			UpdatedAt:    b.updatedAt,
+		}
+
+		for _, slot := range b.calls {
+			if now.Unix()/60-slot.minute < 60 {
+				status.ConsumedLastHour += slot.count
+			}
+		}
+
+		if name == "core" {
+			status.Reserved = int(q.reserved.Load())
+		}
+
+		buckets[name] = status
+	}
+
+	return buckets
+}
+
+// quotaTransport keeps the quota sent by Github in the headers of each response
+type quotaTransport struct {
+	base    http.RoundTripper
+	tracker *quotaTracker
+}
+
+func (t quotaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		return res, err
+	}
+
+	resource := res.Header.Get("X-RateLimit-Resource")
+	limit, limitErr := strconv.Atoi(res.Header.Get("X-RateLimit-Limit"))
+	remaining, remainingErr := strconv.Atoi(res.Header.Get("X-RateLimit-Remaining"))
+	reset, resetErr := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64)
+
+	// only known buckets are kept, other ones are not used by the service
+	if (resource != "core" && resource != "search") || limitErr != nil || remainingErr != nil || resetErr != nil {
+		return res, nil
+	}
+
+	now := time.Now()
+
+	// the rate limit endpoint and conditional requests not modified are not counted by Github
+	if githubEndpoint(req.URL.Path) != "rate_limit" && res.StatusCode != http.StatusNotModified {
+		t.tracker.consume(resource, now)
+	}
+
+	t.tracker.update(resource, model.QuotaBucket{Limit: limit, Remaining: remaining, Reset: time.Unix(reset, 0)}, now)
+
+	return res, nil
+}
+
+// QuotaStatus returns the view of the service on each Github bucket
+func (s githubService) QuotaStatus() model.QuotaStatus {
+	cacheOnly, _ := s.QuotaLow()
+
+	return model.QuotaStatus{
+		CacheOnly:        cacheOnly,
+		Buckets:          s.quota.status(time.Now()),
+		LocalRateLimiter: s.RateLimitState(),
+		Lanes:            s.lanes.status(),
+	}
+}
+
+// QuotaLow returns true while a bucket is under its low-water mark, with the time when the quota is reset.
+// Then /repos is served from cache only
+func (s githubService) QuotaLow() (bool, time.Time) {
+	return s.quota.low(time.Now())
+}
+
+// QuotaAlerts returns the alerts sent when a bucket crosses its low-water mark
+func (s githubService) QuotaAlerts() <-chan model.QuotaAlert {
+	return s.quota.alerts
+}
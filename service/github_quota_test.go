@@ -0,0 +1,109 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestQuotaTracker checks the alerts sent when a bucket crosses its low-water mark, and the end of the low quota at the reset
+func TestQuotaTracker(t *testing.T) {
+	tracker := newQuotaTracker(config.QuotaConfig{CoreLowWaterMark: 2})
+
+	now := time.Now()
+	reset := now.Add(time.Hour)
+
+	tracker.update("core", model.QuotaBucket{Limit: 5000, Remaining: 150, Reset: reset}, now)
+	low, _ := tracker.low(now)
+	assert.False(t, low)
+	assert.Empty(t, tracker.alerts)
+
+	// an alert is sent once when crossing the mark
+	tracker.update("core", model.QuotaBucket{Limit: 5000, Remaining: 99, Reset: reset}, now)
+	tracker.update("core", model.QuotaBucket{Limit: 5000, Remaining: 98, Reset: reset}, now)
+
+	assert.Len(t, tracker.alerts, 1)
+	assert.Equal(t, model.QuotaAlert{Event: QuotaLowEvent, Bucket: "core", Limit: 5000, Remaining: 99, LowWaterMark: 100, Reset: reset}, <-tracker.alerts)
+
+	low, lowUntil := tracker.low(now)
+	assert.True(t, low)
+	assert.Equal(t, reset, lowUntil)
+
+	// the quota is not low anymore after the reset, even without new call
+	low, _ = tracker.low(reset.Add(time.Second))
+	assert.False(t, low)
+
+	// a search bucket without mark is never low
+	tracker.update("search", model.QuotaBucket{Limit: 30, Remaining: 0, Reset: reset}, now)
+	assert.Empty(t, tracker.alerts)
+
+	tracker.update("core", model.QuotaBucket{Limit: 5000, Remaining: 5000, Reset: reset.Add(time.Hour)}, reset)
+	assert.Equal(t, QuotaRecoveredEvent, (<-tracker.alerts).Event)
+}
+
+// TestQuotaTrackerWithoutToken checks that the default low-water mark follows the limit of 60 requests without token
+func TestQuotaTrackerWithoutToken(t *testing.T) {
+	tracker := newQuotaTracker(config.GetDefault().Quota)
+
+	now := time.Now()
+	reset := now.Add(time.Hour)
+
+	tracker.update("core", model.QuotaBucket{Limit: 60, Remaining: 60, Reset: reset}, now)
+	low, _ := tracker.low(now)
+	assert.False(t, low)
+	assert.Equal(t, 6, tracker.status(now)["core"].LowWaterMark)
+
+	tracker.update("core", model.QuotaBucket{Limit: 60, Remaining: 5, Reset: reset}, now)
+	low, _ = tracker.low(now)
+	assert.True(t, low)
+}
+
+// TestQuotaTransport checks that the quota is kept from the response headers, and that calls counted by Github are consumed
+func TestQuotaTransport(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Resource", "core")
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "4990")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+		if r.Header.Get("If-None-Match") != "" {
+			w.WriteHeader(http.StatusNotModified)
+		}
+	}))
+
+	defer server.Close()
+
+	tracker := newQuotaTracker(config.QuotaConfig{})
+	tracker.reserved.Add(3)
+	client := &http.Client{Transport: quotaTransport{base: http.DefaultTransport, tracker: tracker}}
+
+	for _, path := range []string{"/repos/owner1/repo1/languages", "/repos/owner2/repo2/languages", "/rate_limit"} {
+		res, err := client.Get(server.URL + path)
+		assert.NoError(t, err)
+		res.Body.Close()
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/events", nil)
+	req.Header.Set("If-None-Match", `"etag"`)
+	res, err := client.Do(req)
+	assert.NoError(t, err)
+	res.Body.Close()
+
+	status := tracker.status(time.Now())["core"]
+	assert.Equal(t, 4990, status.Remaining)
+	assert.Equal(t, 5000, status.Limit)
+	assert.True(t, reset.Equal(status.Reset))
+	assert.Equal(t, 2, status.ConsumedLastHour)
+	assert.Equal(t, 3, status.Reserved)
+
+	// calls older than one hour are not counted anymore
+	assert.Equal(t, 0, tracker.status(time.Now().Add(time.Hour))["core"].ConsumedLastHour)
+}
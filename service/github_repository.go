@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/google/go-github/v66/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// RefreshRepository loads the languages of a single repository, then writes it through the storage and the events buffer.
+// Used when Github notifies a change on a repository, so the whole search doesn't need to be executed again.
+// If isNew is true, the repository is added to the last repositories created
+func (s githubService) RefreshRepository(ctx context.Context, repo model.GithubRepository, isNew bool) (model.GithubRepository, error) {
+	if err := s.allowTokens(ctx, 1); err != nil {
+		log.WithContext(ctx).Warning("the Github rate limit has been reached. Use a token or wait until the limit reset")
+		return model.GithubRepository{}, err
+	}
+
+	log.WithContext(ctx).WithFields(log.Fields{
+		"repositoryID": repo.ID,
+		"fullName":     repo.FullName,
+	}).Debug("refresh languages for repository")
+
+	var languages map[string]int
+
+	_, err := s.callWithRetry(ctx, func(ctx context.Context) (*github.Response, error) {
+		var res *github.Response
+		var err error
+
+		languages, res, err = s.githubClient.Repositories.ListLanguages(ctx, repo.Owner, repo.Repository)
+		return res, err
+	})
+
+	if err != nil {
+		return model.GithubRepository{}, s.HandleRequestErrors(err)
+	}
+
+	repo.Languages = languages
+	repo.MostUsedLanguage = mostUsedLanguage(languages)
+
+	s.eventsBuffer.upsert(repo, isNew)
+	s.SaveRepositories([]model.GithubRepository{repo})
+
+	return repo, nil
+}
+
+// RemoveRepository deletes a repository from the storage and the events buffer,
+// when it has been deleted or is not public anymore
+func (s githubService) RemoveRepository(repo model.GithubRepository) error {
+	s.eventsBuffer.remove(repo.ID)
+
+	if err := s.storage.DeleteRepository(repo.ID); err != nil {
+		return s.handleStorageErrors(err, repo.FullName)
+	}
+
+	return nil
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"net/http"
+
+	"github.com/Scalingo/sclng-backend-test-v1/logger"
+)
+
+// Header sent to Github with the ID of the request at the origin of the call
+const upstreamRequestIDHeader = "X-Request-ID"
+
+// requestIDTransport sends the request ID held by the context with every call to Github,
+// so upstream calls can be traced back to the request at their origin
+type requestIDTransport struct {
+	base http.RoundTripper
+}
+
+func (t requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if requestID := logger.RequestIDFromContext(req.Context()); requestID != "" {
+		// a RoundTripper must not modify the request received
+		req = req.Clone(req.Context())
+		req.Header.Set(upstreamRequestIDHeader, requestID)
+	}
+
+	return t.base.RoundTrip(req)
+}
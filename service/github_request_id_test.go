@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/logger"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	"github.com/google/go-github/v66/github"
+	githubMock "github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+// TestRequestIDSentToGithub checks that the request ID is sent with the search and with each languages call
+func TestRequestIDSentToGithub(t *testing.T) {
+	received := make(chan string, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get(upstreamRequestIDHeader)
+
+		if r.URL.Path == "/search/repositories" {
+			_, _ = w.Write(githubMock.MustMarshal(github.RepositoriesSearchResult{
+				Repositories: []*github.Repository{
+					{ID: github.Int64(1), FullName: github.String("owner1/repo1"), Owner: &github.User{Login: github.String("owner1")}, Name: github.String("repo1"), Language: github.String("Go")},
+				},
+			}))
+
+			return
+		}
+
+		_, _ = w.Write(githubMock.MustMarshal(map[string]int{"Go": 100}))
+	}))
+
+	defer server.Close()
+
+	githubClient := github.NewClient(server.Client())
+	githubClient.BaseURL, _ = url.Parse(server.URL + "/")
+
+	svc := NewGithubService(*config.GetDefault(), githubClient, rate.NewLimiter(rate.Every(time.Hour), 10), storage.NewNoopStorage())
+
+	ctx := logger.ContextWithRequestID(context.Background(), "request-1")
+	_, err := svc.FetchLastHundredRepositories(ctx, model.SearchQuery{})
+	assert.NoError(t, err)
+
+	close(received)
+
+	calls := 0
+	for requestID := range received {
+		assert.Equal(t, "request-1", requestID)
+		calls += 1
+	}
+
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/google/go-github/v66/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// callWithRetry executes a call to Github, each attempt with its own timeout.
+// Calls failing with a 5xx error, a timeout or the secondary rate limit are retried with a jittered exponential backoff,
+// until the configured number of attempts. Each retry is a new request, so it consumes a token from the rate limiter
+func (s githubService) callWithRetry(ctx context.Context, call func(ctx context.Context) (*github.Response, error)) (*github.Response, error) {
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := s.upstreamContext(ctx)
+		res, err := call(attemptCtx)
+		cancel()
+
+		if err == nil || attempt >= s.config.Github.MaxAttempts || ctx.Err() != nil {
+			return res, err
+		}
+
+		delay, hinted, retryable := s.retryDelay(err, attempt)
+		if !retryable {
+			return res, err
+		}
+
+		// waiting longer than the backoff or the time left would end with a timeout, the client gets the delay instead
+		if hinted && !s.canWait(ctx, delay) {
+			return res, retryLaterError(err, delay)
+		}
+
+		// Github is now considered unavailable, a retry would be rejected anyway
+		if s.breaker.rejects() {
+			return res, errCircuitOpen
+		}
+
+		if s.allowTokens(ctx, 1) != nil {
+			log.WithContext(ctx).WithError(err).Warning("not enought requests in rate limiter to retry the call to github")
+			return res, err
+		}
+
+		log.WithContext(ctx).WithFields(log.Fields{
+			"attempt": attempt,
+			"delay":   delay,
+		}).WithError(err).Warning("call to github failed. will retry")
+
+		select {
+		case <-ctx.Done():
+			return res, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// retryDelay returns the delay to wait before the next attempt, or false if the error is not transient.
+// The delay is hinted when it's the one asked by Github with Retry-After.
+// The primary rate limit is not retried, because it's only reset after one hour
+func (s githubService) retryDelay(err error, attempt int) (time.Duration, bool, bool) {
+	var rateLimitErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	var responseErr *github.ErrorResponse
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &rateLimitErr):
+		return 0, false, false
+
+	case errors.As(err, &abuseErr):
+		if abuseErr.RetryAfter != nil {
+			return *abuseErr.RetryAfter, true, true
+		}
+
+		return s.backoff(attempt), false, true
+
+	case errors.As(err, &responseErr):
+		if responseErr.Response == nil {
+			return 0, false, false
+		}
+
+		status := responseErr.Response.StatusCode
+		if status < http.StatusInternalServerError && status != http.StatusTooManyRequests {
+			return 0, false, false
+		}
+
+		if retryAfter, found := parseRetryAfter(responseErr.Response); found {
+			return retryAfter, true, true
+		}
+
+		return s.backoff(attempt), false, true
+
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return s.backoff(attempt), false, true
+	}
+
+	return 0, false, false
+}
+
+// canWait returns false if the delay is longer than the maximum backoff or than the time left before the deadline
+func (s githubService) canWait(ctx context.Context, delay time.Duration) bool {
+	if delay > time.Duration(s.config.Github.MaxBackoff)*time.Millisecond {
+		return false
+	}
+
+	deadline, found := ctx.Deadline()
+
+	return !found || delay < time.Until(deadline)
+}
+
+// retryLaterError returns the error of a call not retried because Github asked to wait too long, with the delay asked
+func retryLaterError(err error, delay time.Duration) error {
+	var responseErr *github.ErrorResponse
+
+	if errors.As(err, &responseErr) && responseErr.Response != nil && responseErr.Response.StatusCode >= http.StatusInternalServerError {
+		return model.ErrUpstreamUnavailable.Wrap(err).WithRetryAfter(delay)
+	}
+
+	return model.ErrSecondaryRateLimitReached.Wrap(err).WithRetryAfter(delay)
+}
+
+// backoff returns the exponential delay for an attempt, capped to the configured maximum.
+// A random jitter between half and the full delay is applied, so concurrent calls don't retry at the same time
+func (s githubService) backoff(attempt int) time.Duration {
+	delay := time.Duration(s.config.Github.InitialBackoff) * time.Millisecond
+	maxDelay := time.Duration(s.config.Github.MaxBackoff) * time.Millisecond
+
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// parseRetryAfter reads the Retry-After header, sent by Github as a number of seconds
+func parseRetryAfter(res *http.Response) (time.Duration, bool) {
+	seconds, err := strconv.Atoi(res.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	"github.com/google/go-github/v66/github"
+	githubMock "github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+// TestCallWithRetry will test the retry policy against a fake Github server injecting failures
+func TestCallWithRetry(t *testing.T) {
+	tests := []struct {
+		name               string
+		rateLimit          int
+		maxBackoff         int
+		handler            func(w http.ResponseWriter, attempt int32)
+		expectedAttempts   int32
+		expectedErrMsg     string
+		expectedRetryAfter time.Duration
+		expectedRemaining  int
+	}{
+		{
+			name:      "Server errors retried until success",
+			rateLimit: 10,
+			handler: func(w http.ResponseWriter, attempt int32) {
+				if attempt < 3 {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+
+				_, _ = w.Write(githubMock.MustMarshal(map[string]int{"Go": 10}))
+			},
+			expectedAttempts:  3,
+			expectedRemaining: 7,
+		},
+		{
+			name:      "Server errors until max attempts",
+			rateLimit: 10,
+			handler: func(w http.ResponseWriter, _ int32) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			expectedAttempts:  3,
+			expectedErrMsg:    "FETCH_ERROR",
+			expectedRemaining: 7,
+		},
+		{
+			name:       "Secondary rate limit retried after Retry-After",
+			rateLimit:  10,
+			maxBackoff: 2000,
+			handler: func(w http.ResponseWriter, attempt int32) {
+				if attempt == 1 {
+					w.Header().Set("Retry-After", "1")
+					w.WriteHeader(http.StatusForbidden)
+					_, _ = w.Write([]byte(`{"message":"You have exceeded a secondary rate limit","documentation_url":"https://docs.github.com/rest/overview/rate-limits-for-the-rest-api#about-secondary-rate-limits"}`))
+					return
+				}
+
+				_, _ = w.Write(githubMock.MustMarshal(map[string]int{"Go": 10}))
+			},
+			expectedAttempts:  2,
+			expectedRemaining: 8,
+		},
+		{
+			name:      "Secondary rate limit not retried when Retry-After is longer than the maximum backoff",
+			rateLimit: 10,
+			handler: func(w http.ResponseWriter, _ int32) {
+				w.Header().Set("Retry-After", "60")
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"message":"You have exceeded a secondary rate limit","documentation_url":"https://docs.github.com/rest/overview/rate-limits-for-the-rest-api#about-secondary-rate-limits"}`))
+			},
+			expectedAttempts:   1,
+			expectedErrMsg:     "SECONDARY_RATE_LIMIT_REACHED",
+			expectedRetryAfter: time.Minute,
+			expectedRemaining:  9,
+		},
+		{
+			name:       "Server errors not retried when Retry-After is longer than the request timeout",
+			rateLimit:  10,
+			maxBackoff: 600000,
+			handler: func(w http.ResponseWriter, _ int32) {
+				w.Header().Set("Retry-After", "300")
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			expectedAttempts:   1,
+			expectedErrMsg:     "UPSTREAM_UNAVAILABLE",
+			expectedRetryAfter: 5 * time.Minute,
+			expectedRemaining:  9,
+		},
+		{
+			name:      "Client errors not retried",
+			rateLimit: 10,
+			handler: func(w http.ResponseWriter, _ int32) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			expectedAttempts:  1,
+			expectedErrMsg:    "FETCH_ERROR",
+			expectedRemaining: 9,
+		},
+		{
+			name:      "No retry without available requests in rate limiter",
+			rateLimit: 1,
+			handler: func(w http.ResponseWriter, _ int32) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			expectedAttempts:  1,
+			expectedErrMsg:    "FETCH_ERROR",
+			expectedRemaining: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				tt.handler(w, attempts.Add(1))
+			}))
+
+			defer server.Close()
+
+			githubClient := github.NewClient(server.Client())
+			githubClient.BaseURL, _ = url.Parse(server.URL + "/")
+
+			conf := config.GetDefault()
+			conf.Github.InitialBackoff = 1
+			conf.Github.MaxBackoff = 10
+			if tt.maxBackoff > 0 {
+				conf.Github.MaxBackoff = tt.maxBackoff
+			}
+
+			mockedRateLimiter := rate.NewLimiter(rate.Every(time.Hour), tt.rateLimit)
+			svc := NewGithubService(*conf, githubClient, mockedRateLimiter, storage.NewNoopStorage())
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			_, err := svc.RefreshRepository(ctx, model.GithubRepository{ID: 1, FullName: "owner/repo", Owner: "owner", Repository: "repo"}, false)
+
+			if tt.expectedErrMsg != "" {
+				assert.EqualError(t, err, tt.expectedErrMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if tt.expectedRetryAfter > 0 {
+				var apiErr *model.Error
+				assert.ErrorAs(t, err, &apiErr)
+				assert.Equal(t, tt.expectedRetryAfter, apiErr.RetryAfter)
+			}
+
+			// the first attempt is counted by RefreshRepository itself, then one token per retry
+			assert.Equal(t, tt.expectedAttempts, attempts.Load())
+			assert.InDelta(t, tt.expectedRemaining, mockedRateLimiter.Tokens(), 0.01)
+		})
+	}
+}
+
+// TestBackoff checks that delays grow exponentially with jitter, and never exceed the maximum
+func TestBackoff(t *testing.T) {
+	conf := config.GetDefault()
+	conf.Github.InitialBackoff = 100
+	conf.Github.MaxBackoff = 1000
+	svc := githubService{config: *conf}
+
+	for attempt, expectedMax := range map[int]time.Duration{1: 100, 2: 200, 3: 400, 4: 800, 5: 1000, 10: 1000} {
+		delay := svc.backoff(attempt)
+		assert.GreaterOrEqual(t, delay, expectedMax*time.Millisecond/2)
+		assert.LessOrEqual(t, delay, expectedMax*time.Millisecond)
+	}
+}
@@ -2,50 +2,238 @@ package service
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/metrics"
 	"github.com/Scalingo/sclng-backend-test-v1/model"
-	"github.com/gin-gonic/gin"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	"github.com/Scalingo/sclng-backend-test-v1/tracing"
 	"github.com/google/go-github/v66/github"
 
-	"github.com/remeh/sizedwaitgroup"
 	log "github.com/sirupsen/logrus"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
 	"golang.org/x/time/rate"
 )
 
 type GithubService interface {
-	FetchLastHundredRepositories(ctx *gin.Context, seachQuery model.SearchQuery) ([]model.GithubRepository, error)
-	GetRepositoriesLanguages(repos []model.GithubRepository) ([]model.GithubRepository, error)
-	FetchLanguagesForSingleRepository(r model.GithubRepository, swg *sizedwaitgroup.SizedWaitGroup, ch chan<- model.GithubRepositoryLanguages) error
-
+	FetchLastHundredRepositories(ctx context.Context, seachQuery model.SearchQuery) ([]model.GithubRepository, error)
+	CoalesceLastHundredRepositories(ctx context.Context, seachQuery model.SearchQuery) ([]model.GithubRepository, bool, error)
+	SearchRepositories(ctx context.Context, seachQuery model.SearchQuery) ([]model.GithubRepository, error)
+	FetchRepositoriesLanguages(ctx context.Context, repos []model.GithubRepository) ([]model.GithubRepository, error)
+	FetchLastHundredRepositoriesPartial(ctx context.Context, seachQuery model.SearchQuery) (model.PartialRepositories, error)
+	StreamLastHundredRepositories(ctx context.Context, seachQuery model.SearchQuery, emit func(model.StreamEvent)) error
+	EstimateLastHundredRepositories(ctx context.Context, seachQuery model.SearchQuery) (model.CostEstimate, error)
+	GetRepositoriesLanguages(ctx context.Context, repos []model.GithubRepository) ([]model.GithubRepository, int)
+	LoadRepositoriesLanguages(ctx context.Context, repos []model.GithubRepository) <-chan model.GithubRepositoryLanguages
+	FetchLanguagesForSingleRepository(ctx context.Context, r model.GithubRepository, ch chan<- model.GithubRepositoryLanguages) error
+
+	PollRepositoryEvents(ctx context.Context)
+	FetchRepositoryEvents(ctx context.Context) (time.Duration, error)
+	FetchRepositoriesFromEvents(seachQuery model.SearchQuery) ([]model.GithubRepository, error)
+
+	SaveRepositories(repos []model.GithubRepository)
+	GetRepositoryHistory(owner string, name string) (model.RepositoryHistory, error)
+	RefreshRepository(ctx context.Context, repo model.GithubRepository, isNew bool) (model.GithubRepository, error)
+	RemoveRepository(repo model.GithubRepository) error
+
+	CachedRepositories(seachQuery model.SearchQuery) ([]model.GithubRepository, time.Time, bool)
+	CacheEntries() int
+	GithubQuota(ctx context.Context) (map[string]model.QuotaBucket, error)
+	BootstrapRateLimiter(ctx context.Context)
+	RateLimiterReady() bool
+	CircuitBreakerState() string
+	ConcurrencyLevel() int
+	RateLimitState() model.RateLimitState
+	QuotaStatus() model.QuotaStatus
+	QuotaLow() (bool, time.Time)
+	QuotaAlerts() <-chan model.QuotaAlert
+	WithLane(ctx context.Context, lane string) (context.Context, error)
 	HandleRequestErrors(err error) error
 }
 
 type githubService struct {
 	githubClient      *github.Client
+	eventsClient      *github.Client
+	eventsBuffer      *repositoryEventsBuffer
+	breaker           *circuitBreaker
+	concurrency       *adaptiveLimiter
+	bootstrap         *rateLimiterBootstrap
+	quota             *quotaTracker
+	lanes             *priorityLanes
+	cache             *resultsCache
+	requests          *singleflight.Group
 	githubRateLimiter *rate.Limiter
+	storage           storage.Storage
 	config            config.Config
 }
 
 // NewGithubService will create an instance of GithubService
-func NewGithubService(config config.Config, githubClient *github.Client, rateLimiter *rate.Limiter) GithubService {
+func NewGithubService(config config.Config, githubClient *github.Client, rateLimiter *rate.Limiter, storage storage.Storage) GithubService {
+	eventsBuffer := &repositoryEventsBuffer{}
+	breaker := newCircuitBreaker(config.Breaker)
+	concurrency := newAdaptiveLimiter(config.Tasks)
+	quota := newQuotaTracker(config.Quota)
+
+	// every call to Github is traced, sent with the request ID, through the circuit breaker,
+	// reported to the adaptive limiter, and keeps the quota sent in the response headers
+	githubClient = wrapTransport(githubClient, func(transport http.RoundTripper) http.RoundTripper {
+		transport = tracingTransport{base: transport}
+		transport = requestIDTransport{base: transport}
+		transport = circuitBreakerTransport{base: transport, breaker: breaker}
+		transport = adaptiveConcurrencyTransport{base: transport, limiter: concurrency}
+		transport = quotaTransport{base: transport, tracker: quota}
+
+		return metricsTransport{base: transport}
+	})
+
+	// events are polled with conditional requests, using the ETag stored in the events buffer
+	eventsClient := wrapTransport(githubClient, func(base http.RoundTripper) http.RoundTripper {
+		return conditionalRequestTransport{base: base, buffer: eventsBuffer}
+	})
+
 	return githubService{
 		githubClient:      githubClient,
+		eventsClient:      eventsClient,
+		eventsBuffer:      eventsBuffer,
+		breaker:           breaker,
+		concurrency:       concurrency,
+		bootstrap:         &rateLimiterBootstrap{},
+		quota:             quota,
+		lanes:             newPriorityLanes(config.Lanes, rateLimiter),
+		cache:             newResultsCache(config.Cache),
+		requests:          &singleflight.Group{},
 		githubRateLimiter: rateLimiter,
+		storage:           storage,
 		config:            config,
 	}
 }
 
-func (s githubService) FetchLastHundredRepositories(c *gin.Context, seachQuery model.SearchQuery) ([]model.GithubRepository, error) {
-	if !s.githubRateLimiter.Allow() {
-		log.Warning("the Github rate limit has been reached. Use a token or wait until the limit reset")
-		return []model.GithubRepository{}, fmt.Errorf("RATE_LIMIT_REACHED")
+// wrapTransport creates a copy of the Github client, sharing the same transport (and so the same authentication)
+// but wrapped by the function given. URLs and user agent of the client are kept
+func wrapTransport(githubClient *github.Client, wrap func(http.RoundTripper) http.RoundTripper) *github.Client {
+	httpClient := githubClient.Client()
+
+	transport := httpClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	httpClient.Transport = wrap(transport)
+
+	wrappedClient := github.NewClient(httpClient)
+	wrappedClient.BaseURL = githubClient.BaseURL
+	wrappedClient.UploadURL = githubClient.UploadURL
+	wrappedClient.UserAgent = githubClient.UserAgent
+
+	return wrappedClient
+}
+
+// FetchLastHundredRepositories fetches the last 100 repositories matching the filters with all their languages.
+// If the context is done before all languages are loaded, remaining requests are not sent and their tokens given back
+func (s githubService) FetchLastHundredRepositories(ctx context.Context, seachQuery model.SearchQuery) ([]model.GithubRepository, error) {
+	ctx, span := tracing.Start(ctx, "FetchLastHundredRepositories", tracing.QueryAttributes(seachQuery)...)
+	span.SetAttributes(attribute.Float64("ratelimit.tokens_available", s.githubRateLimiter.Tokens()))
+
+	repos, err := s.fetchLastHundredRepositories(ctx, seachQuery)
+
+	span.SetAttributes(attribute.Int("repositories.count", len(repos)))
+	tracing.End(span, err)
+
+	return repos, err
+}
+
+func (s githubService) fetchLastHundredRepositories(ctx context.Context, seachQuery model.SearchQuery) ([]model.GithubRepository, error) {
+	// With the events source, repositories are already loaded in background by PollRepositoryEvents
+	// so no request to Github is made here
+	if s.config.Github.Source == config.GithubSourceEvents {
+		return s.FetchRepositoriesFromEvents(seachQuery)
+	}
+
+	repositoriesAggregated, err := s.SearchRepositories(ctx, seachQuery)
+	if err != nil {
+		return []model.GithubRepository{}, err
+	}
+
+	// languages already in the recent results of the same search are not requested again
+	loaded, err := s.FetchRepositoriesLanguages(ctx, s.withCachedLanguages(seachQuery, repositoriesAggregated))
+	if err != nil {
+		return []model.GithubRepository{}, err
+	}
+
+	loadedByID := make(map[int64]map[string]int, len(loaded))
+	for _, r := range loaded {
+		loadedByID[r.ID] = r.Languages
+	}
+
+	for i, r := range repositoriesAggregated {
+		if languages, found := loadedByID[r.ID]; found {
+			repositoriesAggregated[i].Languages = languages
+		}
+	}
+
+	s.cache.put(seachQuery, repositoriesAggregated, time.Now())
+	return repositoriesAggregated, nil
+}
+
+// FetchRepositoriesLanguages loads the languages of all repositories found by SearchRepositories and saves them.
+// Tokens are reserved for all repositories first, so languages are either all loaded or not loaded at all
+func (s githubService) FetchRepositoriesLanguages(ctx context.Context, repos []model.GithubRepository) ([]model.GithubRepository, error) {
+	reservation, err := s.reserveLanguagesTokens(ctx, repos)
+	if err != nil {
+		return []model.GithubRepository{}, err
+	}
+
+	// Aggregate and fetch the languages used in each repository concurrently using goroutines.
+	repos, skipped := s.GetRepositoriesLanguages(ctx, repos)
+	reservation.giveBack(skipped)
+
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("ratelimit.tokens_reserved", reservation.tokens),
+		attribute.Int("ratelimit.tokens_given_back", skipped),
+	)
+
+	s.SaveRepositories(repos)
+
+	// Languages loaded are kept in storage, but the response would be incomplete
+	if ctx.Err() != nil {
+		return []model.GithubRepository{}, contextError(ctx.Err())
 	}
 
-	log.WithFields(log.Fields{
+	return repos, nil
+}
+
+// SearchRepositories fetches the last 100 repositories matching the filters, without their languages
+func (s githubService) SearchRepositories(ctx context.Context, seachQuery model.SearchQuery) ([]model.GithubRepository, error) {
+	ctx, span := tracing.Start(ctx, "SearchRepositories", tracing.QueryAttributes(seachQuery)...)
+
+	repos, err := s.searchRepositories(ctx, seachQuery)
+
+	span.SetAttributes(attribute.Int("repositories.count", len(repos)))
+	tracing.End(span, err)
+
+	return repos, err
+}
+
+func (s githubService) searchRepositories(ctx context.Context, seachQuery model.SearchQuery) ([]model.GithubRepository, error) {
+	// fail fast before consuming any token while Github is known to be unavailable
+	if s.breaker.rejects() {
+		log.WithContext(ctx).Warning("circuit breaker open. github is considered unavailable")
+		return []model.GithubRepository{}, s.upstreamUnavailable(errCircuitOpen)
+	}
+
+	if err := s.allowTokens(ctx, 1); err != nil {
+		log.WithContext(ctx).WithError(err).Warning("the Github rate limit has been reached. Use a token or wait until the limit reset")
+		return []model.GithubRepository{}, err
+	}
+
+	log.WithContext(ctx).WithFields(log.Fields{
 		"owner":    seachQuery.Owner,
 		"licence":  seachQuery.License,
 		"language": seachQuery.Language,
@@ -55,97 +243,150 @@ func (s githubService) FetchLastHundredRepositories(c *gin.Context, seachQuery m
 	// By applying filters directly in the GitHub Search API, we can reduce the
 	// number of results returned, minimizing the need for additional filtering
 	// and processing after retrieval. This optimizes performance and reduces unnecessary iterations.
-	repos, _, err := s.githubClient.Search.Repositories(
-		context.Background(),
-		seachQuery.ToGithubQuery(true),
-		&github.SearchOptions{
-			Sort:  "created",
-			Order: "desc",
-			ListOptions: github.ListOptions{
-				Page:    1,
-				PerPage: 100,
+	var repos *github.RepositoriesSearchResult
+
+	_, err := s.callWithRetry(ctx, func(ctx context.Context) (*github.Response, error) {
+		var res *github.Response
+		var err error
+
+		repos, res, err = s.githubClient.Search.Repositories(
+			ctx,
+			seachQuery.ToGithubQuery(true),
+			&github.SearchOptions{
+				Sort:  "created",
+				Order: "desc",
+				ListOptions: github.ListOptions{
+					Page:    1,
+					PerPage: 100,
+				},
 			},
-		},
-	)
+		)
+
+		return res, err
+	})
 
 	if err != nil {
-		return []model.GithubRepository{}, fmt.Errorf("FETCH_ERROR")
+		return []model.GithubRepository{}, s.HandleRequestErrors(err)
 	}
 
 	// Construct the output format for each repository.
 	repositoriesAggregated := make([]model.GithubRepository, 0)
 
 	for _, r := range repos.Repositories {
+		repositoryAggregated, ok := repositoryFromGithub(r)
 
-		if r == nil || r.FullName == nil || r.Owner == nil || r.Owner.Login == nil || r.Name == nil {
-			log.WithFields(log.Fields{
-				"repositoryID": r.ID,
+		if !ok {
+			log.WithContext(ctx).WithFields(log.Fields{
+				"repositoryID": r.GetID(),
 			}).Debug("repository found with invalid information. skipped")
 
-			return []model.GithubRepository{}, fmt.Errorf("INVALID_DATA_FOUND")
-		}
-
-		repositoryAggregated := model.GithubRepository{
-			ID:               *r.ID,
-			FullName:         *r.FullName,
-			Owner:            *r.Owner.Login,
-			Repository:       *r.Name,
-			MostUsedLanguage: r.Language,
-		}
-
-		// Extract license information.
-		// The license field can be null or empty for some repositories,
-		if r.License != nil {
-			repositoryAggregated.License = r.License.GetKey()
+			return []model.GithubRepository{}, model.ErrInvalidData
 		}
 
 		repositoriesAggregated = append(repositoriesAggregated, repositoryAggregated)
 	}
 
+	return repositoriesAggregated, nil
+}
+
+// reserveLanguagesTokens consumes from the rate limiter the tokens required to load languages of all repositories
+func (s githubService) reserveLanguagesTokens(ctx context.Context, repositoriesAggregated []model.GithubRepository) (*tokensReservation, error) {
 	// Count the number of repositories that have languages available for loading.
 	// If the rate limiter doesn't have enough available requests to load all languages,
 	// return an error to prevent partially loading the data. This ensures that
 	// language data is either fully loaded or not loaded at all, maintaining consistency.
-	reposWithLanguagesToLoad := 0
-
-	for _, r := range repositoriesAggregated {
-		if r.MostUsedLanguage != nil {
-			reposWithLanguagesToLoad += 1
-		}
-	}
+	reposWithLanguagesToLoad := countRepositoriesWithLanguages(repositoriesAggregated)
 
 	// Rate limit check: consume tokens for each repository that requires language loading.
 	// If there are not enough available requests, return an error to prevent
 	// loading data for only a subset of repositories.
-	if !s.githubRateLimiter.AllowN(time.Now(), reposWithLanguagesToLoad) {
-		log.WithField("repositoriesToLoad", reposWithLanguagesToLoad).Warning("not enought requests in rate limiter to load languages for all repositories")
-		return []model.GithubRepository{}, fmt.Errorf("RATE_LIMIT_REACHED")
+	reservation, err := s.reserveTokens(ctx, reposWithLanguagesToLoad)
+	if err != nil {
+		log.WithContext(ctx).WithField("repositoriesToLoad", reposWithLanguagesToLoad).WithError(err).Warning("not enought requests in rate limiter to load languages for all repositories")
+		return nil, err
 	}
 
-	log.WithFields(log.Fields{
+	log.WithContext(ctx).WithFields(log.Fields{
 		"numberOfRepositories": reposWithLanguagesToLoad,
 	}).Debug("will load languages from all repositories found with main language available")
 
-	// Aggregate and fetch the languages used in each repository concurrently using goroutines.
-	repositoriesAggregated, err = s.GetRepositoriesLanguages(repositoriesAggregated)
+	return reservation, nil
+}
 
-	if err != nil {
-		log.WithError(err).Error("unable to get repositories languages")
-		return []model.GithubRepository{}, fmt.Errorf("FETCH_ERROR")
+// SaveRepositories writes the repositories fetched through the storage, to keep them and their languages history.
+// A storage failure is only logged, because it must not prevent the API from returning fresh data
+func (s githubService) SaveRepositories(repos []model.GithubRepository) {
+	if err := s.storage.SaveRepositories(repos, time.Now()); err != nil {
+		log.WithError(err).WithField("numberOfRepositories", len(repos)).Error("unable to save repositories in storage")
 	}
+}
 
-	return repositoriesAggregated, nil
+// repositoryFromGithub converts a repository returned by Github to the output format.
+// Returns false if mandatory information is missing
+func repositoryFromGithub(r *github.Repository) (model.GithubRepository, bool) {
+	if r == nil || r.ID == nil || r.FullName == nil || r.Owner == nil || r.Owner.Login == nil || r.Name == nil {
+		return model.GithubRepository{}, false
+	}
+
+	repository := model.GithubRepository{
+		ID:               *r.ID,
+		FullName:         *r.FullName,
+		Owner:            *r.Owner.Login,
+		Repository:       *r.Name,
+		MostUsedLanguage: r.Language,
+	}
+
+	// Extract license information.
+	// The license field can be null or empty for some repositories,
+	if r.License != nil {
+		repository.License = r.License.GetKey()
+	}
+
+	return repository, true
 }
 
 // GetRepositoriesLanguages fetches the languages used by each repository provided in the input parameters.
-// This function employs wait groups to parallelize API requests for each repository,
-func (s githubService) GetRepositoriesLanguages(repos []model.GithubRepository) ([]model.GithubRepository, error) {
-	swg := sizedwaitgroup.New(s.config.Tasks.MaxParallelTasksAllowed)
+// This function waits for all languages to be loaded, see LoadRepositoriesLanguages to process them as they arrive.
+// Returns the number of requests not sent because the context was done, so their tokens can be given back
+func (s githubService) GetRepositoriesLanguages(ctx context.Context, repos []model.GithubRepository) ([]model.GithubRepository, int) {
+	results := s.LoadRepositoriesLanguages(ctx, repos)
+	skipped := 0
+
+	// It is preferable to use an array instead of directly using a channel of maps.
+	// Although this approach requires creating an intermediate map, it provides a clearer and more structured representation
+	// Repositories with an error keep nil languages
+	langMap := make(map[int64]map[string]int)
+	for result := range results {
+		if result.Skipped {
+			skipped += 1
+		}
+
+		if result.Error == nil {
+			langMap[result.RepositoryID] = result.Languages
+		}
+	}
+
+	for i := range repos {
+		if lang, found := langMap[repos[i].ID]; found {
+			repos[i].Languages = lang
+		}
+	}
+
+	return repos, skipped
+}
+
+// LoadRepositoriesLanguages starts loading the languages of each repository provided in the input parameters.
+// This function parallelizes API requests for each repository, the number of concurrent requests being adapted
+// to the health of Github (see adaptiveLimiter).
+// Results (or errors) are sent to the returned channel as soon as they arrive, it's closed once all tasks are finished.
+// Once the context is done, requests not started yet are skipped and sent with the context error
+func (s githubService) LoadRepositoriesLanguages(ctx context.Context, repos []model.GithubRepository) <-chan model.GithubRepositoryLanguages {
+	var wg sync.WaitGroup
 
 	// Create a channel to collect responses from all repositories.
-	// The responses will be stored in a map with repository IDs as keys and their corresponding languages as values.
-	// This map will be populated once all concurrent tasks have completed.
+	// It's buffered to never block tasks, even if the caller reads results slowly
 	results := make(chan model.GithubRepositoryLanguages, len(repos))
+	fanOut := 0
 
 	for _, r := range repos {
 
@@ -153,85 +394,136 @@ func (s githubService) GetRepositoriesLanguages(repos []model.GithubRepository)
 		// If a main language is present, it indicates that at least one language can be retrieved using ListLanguages.
 		// If not, calling ListLanguages will return nil or an empty result, allowing us to skip the request
 		if r.MostUsedLanguage == nil {
-			log.WithFields(log.Fields{
+			log.WithContext(ctx).WithFields(log.Fields{
 				"repositoryID": r.ID,
 			}).Debug("repository without most used language. skipped from loading languages list")
 
 			results <- model.GithubRepositoryLanguages{RepositoryID: r.ID, Languages: map[string]int{}}
 		} else {
-			swg.Add()
+			// Wait for a free slot, unless the context is done in the meantime
+			if err := s.concurrency.acquire(ctx); err != nil {
+				results <- model.GithubRepositoryLanguages{RepositoryID: r.ID, Error: contextError(err), Skipped: true}
+				continue
+			}
+
+			// Github became unavailable while loading languages, remaining requests are not sent
+			if s.breaker.rejects() {
+				s.concurrency.release()
+				results <- model.GithubRepositoryLanguages{RepositoryID: r.ID, Error: s.upstreamUnavailable(errCircuitOpen), Skipped: true}
+				continue
+			}
+
+			wg.Add(1)
+			fanOut += 1
+			metrics.LanguagesInFlight.Inc()
 
 			go func(repo model.GithubRepository) {
-				defer swg.Done()
-				err := s.FetchLanguagesForSingleRepository(repo, &swg, results)
+				defer wg.Done()
+				defer s.concurrency.release()
+				defer metrics.LanguagesInFlight.Dec()
+
+				err := s.FetchLanguagesForSingleRepository(ctx, repo, results)
 				if err != nil {
-					log.WithFields(log.Fields{
+					log.WithContext(ctx).WithFields(log.Fields{
 						"repositoryID": repo.ID,
 					}).WithError(err).Error("unable to fetch languages for specific repository")
+
+					// rejected by the circuit breaker, so the request has not been sent
+					results <- model.GithubRepositoryLanguages{RepositoryID: repo.ID, Error: err, Skipped: errors.Is(err, model.ErrUpstreamUnavailable)}
 				}
 			}(r)
 		}
 	}
 
-	// Wait for all tasks to be finished
-	log.Debug("waiting for all threads for loading repositories to be finished")
-	swg.Wait()
-	log.Debug("all threads for loading repositories languages finished")
-
-	// Close the channel
-	close(results)
+	metrics.LanguagesFanOut.Observe(float64(fanOut))
 
-	// It is preferable to use an array instead of directly using a channel of maps.
-	// Although this approach requires creating an intermediate map, it provides a clearer and more structured representation
-	langMap := make(map[int64]map[string]int)
-	for result := range results {
-		langMap[result.RepositoryID] = result.Languages
-	}
+	// Wait for all tasks to be finished in background, then close the channel
+	go func() {
+		log.WithContext(ctx).Debug("waiting for all threads for loading repositories to be finished")
+		wg.Wait()
+		log.WithContext(ctx).Debug("all threads for loading repositories languages finished")
 
-	for i := range repos {
-		if lang, found := langMap[repos[i].ID]; found {
-			repos[i].Languages = lang
-		}
-	}
+		close(results)
+	}()
 
-	return repos, nil
+	return results
 }
 
 // FetchLanguagesForSingleRepository retrieves the languages for a specific repository.
 // The results are sent to a channel and processed in a separate goroutine.
 // Note: Rate limiting is not checked within this function, as it is handled in the parent function.
-func (s githubService) FetchLanguagesForSingleRepository(r model.GithubRepository, swg *sizedwaitgroup.SizedWaitGroup, ch chan<- model.GithubRepositoryLanguages) error {
-	log.WithFields(log.Fields{
+func (s githubService) FetchLanguagesForSingleRepository(ctx context.Context, r model.GithubRepository, ch chan<- model.GithubRepositoryLanguages) error {
+	ctx, span := tracing.Start(ctx, "FetchLanguagesForSingleRepository", tracing.RepositoryAttributes(r)...)
+
+	log.WithContext(ctx).WithFields(log.Fields{
 		"repositoryID":     r.ID,
 		"mostUsedLanguage": r.MostUsedLanguage,
 	}).Debug("fetch languages for repository")
 
-	res, _, err := s.githubClient.Repositories.ListLanguages(
-		context.Background(),
-		r.Owner,
-		r.Repository,
-	)
+	var res map[string]int
+
+	_, err := s.callWithRetry(ctx, func(ctx context.Context) (*github.Response, error) {
+		var response *github.Response
+		var err error
+
+		res, response, err = s.githubClient.Repositories.ListLanguages(
+			ctx,
+			r.Owner,
+			r.Repository,
+		)
+
+		return response, err
+	})
 
 	if err != nil {
-		return s.HandleRequestErrors(err)
+		err = s.HandleRequestErrors(err)
+		tracing.End(span, err)
+
+		return err
 	}
 
+	span.SetAttributes(attribute.Int("languages.count", len(res)))
+	tracing.End(span, nil)
+
 	ch <- model.GithubRepositoryLanguages{RepositoryID: r.ID, Languages: res}
 	return nil
 }
 
 // HandleRequestErrors manages various errors, including GitHub rate limit errors
 // If a rate limit error occurs, this function updates the local rate limiter to consume all available requests,
+// The error returned wraps the one received from Github, with the delay to wait when known
 func (s githubService) HandleRequestErrors(err error) error {
-	if _, ok := err.(*github.RateLimitError); ok {
+	var abuseErr *github.AbuseRateLimitError
+	var rateLimitErr *github.RateLimitError
+	var apiErr *model.Error
+
+	// already converted, when the call was not retried
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	if errors.Is(err, errCircuitOpen) {
+		return s.upstreamUnavailable(err)
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return contextError(err)
+	}
+
+	if errors.As(err, &abuseErr) {
+		log.Warning("the Github secondary rate limit has been reached. Retry later or reduce the number of concurrent requests")
+		return model.ErrSecondaryRateLimitReached.Wrap(err).WithRetryAfter(abuseErr.GetRetryAfter())
+	}
+
+	if errors.As(err, &rateLimitErr) {
 		if !s.githubRateLimiter.AllowN(time.Now(), s.githubRateLimiter.Burst()) {
-			return fmt.Errorf("RATE_LIMITER_ERROR")
+			return model.ErrRateLimiter.Wrap(err)
 		}
 
 		log.Warning("the Github rate limit has been reached. Use a token or wait until the limit reset")
-		return fmt.Errorf("RATE_LIMIT_REACHED")
+		return model.ErrRateLimitReached.Wrap(err).WithRetryAfter(time.Until(rateLimitErr.Rate.Reset.Time))
 	}
 
 	log.WithError(err).Error("error catched when fetching data from github")
-	return fmt.Errorf("FETCH_ERROR")
+	return model.ErrFetch.Wrap(err)
 }
@@ -1,16 +1,18 @@
 package service
 
 import (
+	"context"
 	"net/http"
+	"slices"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/Scalingo/sclng-backend-test-v1/config"
 	"github.com/Scalingo/sclng-backend-test-v1/model"
-	"github.com/gin-gonic/gin"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
 	"github.com/google/go-github/v66/github"
 	githubMock "github.com/migueleliasweb/go-github-mock/src/mock"
-	"github.com/remeh/sizedwaitgroup"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/time/rate"
 )
@@ -176,12 +178,9 @@ func TestFetchLastHundredRepositories(t *testing.T) {
 			mockedRateLimiter := rate.NewLimiter(rate.Every(time.Hour), tt.rateLimit)
 			mockedGithubClient := github.NewClient(mockedHTTPClient)
 			conf := config.GetDefault()
-			svc := NewGithubService(*conf, mockedGithubClient, mockedRateLimiter)
+			svc := NewGithubService(*conf, mockedGithubClient, mockedRateLimiter, storage.NewNoopStorage())
 
-			// Prepare the context and search query
-			gin.SetMode(gin.TestMode)
-			ctx, _ := gin.CreateTestContext(nil)
-			repos, err := svc.FetchLastHundredRepositories(ctx, tt.searchQuery)
+			repos, err := svc.FetchLastHundredRepositories(context.Background(), tt.searchQuery)
 
 			if tt.expectError {
 				assert.Error(t, err)
@@ -195,6 +194,51 @@ func TestFetchLastHundredRepositories(t *testing.T) {
 	}
 }
 
+// TestFetchLastHundredRepositoriesCachedLanguages checks that languages in the recent results of the same search
+// are not requested again, unless the most used language of the repository changed
+func TestFetchLastHundredRepositoriesCachedLanguages(t *testing.T) {
+	result := func(language string) github.RepositoriesSearchResult {
+		return github.RepositoriesSearchResult{
+			Repositories: []*github.Repository{
+				{ID: github.Int64(1), FullName: github.String("owner1/repo1"), Owner: &github.User{Login: github.String("owner1")}, Name: github.String("repo1"), Language: github.String("Go")},
+				{ID: github.Int64(2), FullName: github.String("owner2/repo2"), Owner: &github.User{Login: github.String("owner2")}, Name: github.String("repo2"), Language: github.String(language)},
+			},
+		}
+	}
+
+	var mu sync.Mutex
+	var languagesRequested []string
+
+	mockedHTTPClient := githubMock.NewMockedHTTPClient(
+		githubMock.WithRequestMatch(githubMock.GetSearchRepositories, result("Go"), result("Go"), result("C")),
+		githubMock.WithRequestMatchHandler(
+			githubMock.GetReposLanguagesByOwnerByRepo,
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				languagesRequested = append(languagesRequested, r.URL.Path)
+				mu.Unlock()
+
+				_, _ = w.Write(githubMock.MustMarshal(map[string]int{"Go": 100}))
+			}),
+		),
+	)
+
+	svc := NewGithubService(*config.GetDefault(), github.NewClient(mockedHTTPClient), rate.NewLimiter(rate.Every(time.Hour), 10), storage.NewNoopStorage())
+
+	for i := 0; i < 3; i++ {
+		repos, err := svc.FetchLastHundredRepositories(context.Background(), model.SearchQuery{Language: "Go"})
+		assert.NoError(t, err)
+
+		for _, r := range repos {
+			assert.Equal(t, map[string]int{"Go": 100}, r.Languages)
+		}
+	}
+
+	// the first search loads all languages, the second none, the third only the repository whose language changed
+	slices.Sort(languagesRequested)
+	assert.Equal(t, []string{"/repos/owner1/repo1/languages", "/repos/owner2/repo2/languages", "/repos/owner2/repo2/languages"}, languagesRequested)
+}
+
 // TestFetchLanguagesForSingleRepository test the function called FetchLanguagesForSingleRepository
 func TestFetchLanguagesForSingleRepository(t *testing.T) {
 	tests := []struct {
@@ -237,15 +281,13 @@ func TestFetchLanguagesForSingleRepository(t *testing.T) {
 			mockedRateLimiter := rate.NewLimiter(rate.Every(time.Hour), 60)
 			mockedGithubClient := github.NewClient(mockedHTTPClient)
 			conf := config.GetDefault()
-			svc := NewGithubService(*conf, mockedGithubClient, mockedRateLimiter)
+			svc := NewGithubService(*conf, mockedGithubClient, mockedRateLimiter, storage.NewNoopStorage())
 
-			// Prepare wait group and channel
-			swg := sizedwaitgroup.New(1)
+			// Prepare channel
 			ch := make(chan model.GithubRepositoryLanguages, 1)
 
 			// execute the function
-			swg.Add()
-			err := svc.FetchLanguagesForSingleRepository(tt.repo, &swg, ch)
+			err := svc.FetchLanguagesForSingleRepository(context.Background(), tt.repo, ch)
 
 			if tt.expectError {
 				assert.Error(t, err)
@@ -325,12 +367,12 @@ func TestGetRepositoriesLanguages(t *testing.T) {
 			mockedRateLimiter := rate.NewLimiter(rate.Every(time.Hour), 60)
 			mockedGithubClient := github.NewClient(mockedHTTPClient)
 			conf := config.GetDefault()
-			svc := NewGithubService(*conf, mockedGithubClient, mockedRateLimiter)
+			svc := NewGithubService(*conf, mockedGithubClient, mockedRateLimiter, storage.NewNoopStorage())
 
 			// Call the GetRepositoriesLanguages function
-			repos, err := svc.GetRepositoriesLanguages(tt.repos)
+			repos, skipped := svc.GetRepositoriesLanguages(context.Background(), tt.repos)
 
-			assert.NoError(t, err)
+			assert.Equal(t, 0, skipped)
 
 			// validate that the expected languages were correctly assigned to each repository
 			for _, repo := range repos {
@@ -342,3 +384,136 @@ func TestGetRepositoriesLanguages(t *testing.T) {
 		})
 	}
 }
+
+// TestGetRepositoriesLanguagesCanceled checks that no request is sent once the context is done,
+// and that tokens reserved for these requests are given back to the rate limiter
+func TestGetRepositoriesLanguagesCanceled(t *testing.T) {
+	mockedHTTPClient := githubMock.NewMockedHTTPClient(
+		githubMock.WithRequestMatchHandler(
+			githubMock.GetReposLanguagesByOwnerByRepo,
+			http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+				t.Error("no request should be sent once the context is canceled")
+			}),
+		),
+	)
+
+	mockedRateLimiter := rate.NewLimiter(rate.Every(time.Hour), 10)
+	conf := config.GetDefault()
+	svc := NewGithubService(*conf, github.NewClient(mockedHTTPClient), mockedRateLimiter, storage.NewNoopStorage()).(githubService)
+
+	repos := []model.GithubRepository{
+		{ID: 1, Owner: "owner1", Repository: "repo1", MostUsedLanguage: github.String("Go")},
+		{ID: 2, Owner: "owner2", Repository: "repo2", MostUsedLanguage: github.String("Go")},
+		{ID: 3, Owner: "owner3", Repository: "repo3"},
+	}
+
+	reservation, err := svc.reserveLanguagesTokens(context.Background(), repos)
+	assert.NoError(t, err)
+	assert.InDelta(t, 8, mockedRateLimiter.Tokens(), 0.01)
+	assert.Equal(t, int64(2), svc.quota.reserved.Load())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	repos, skipped := svc.GetRepositoriesLanguages(ctx, repos)
+	reservation.giveBack(skipped)
+
+	assert.Equal(t, 2, skipped)
+	assert.Nil(t, repos[0].Languages)
+	assert.Nil(t, repos[1].Languages)
+	assert.Equal(t, map[string]int{}, repos[2].Languages)
+	assert.InDelta(t, 10, mockedRateLimiter.Tokens(), 0.01)
+	assert.Equal(t, int64(0), svc.quota.reserved.Load())
+}
+
+// TestHandleRequestErrors checks that errors received from Github are converted to typed API errors,
+// keeping the original error as cause and the delay to wait before retrying
+func TestHandleRequestErrors(t *testing.T) {
+	secondaryRetryAfter := 30 * time.Second
+
+	tests := []struct {
+		name               string
+		err                error
+		expectedErr        error
+		expectedStatus     int
+		expectedRetryAfter int
+	}{
+		{
+			name:               "secondary rate limit",
+			err:                &github.AbuseRateLimitError{RetryAfter: &secondaryRetryAfter},
+			expectedErr:        model.ErrSecondaryRateLimitReached,
+			expectedStatus:     http.StatusTooManyRequests,
+			expectedRetryAfter: 30,
+		},
+		{
+			name:           "timeout",
+			err:            context.DeadlineExceeded,
+			expectedErr:    model.ErrRequestTimeout,
+			expectedStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name:           "canceled",
+			err:            context.Canceled,
+			expectedErr:    model.ErrRequestCanceled,
+			expectedStatus: model.StatusClientClosedRequest,
+		},
+		{
+			name:           "circuit open",
+			err:            errCircuitOpen,
+			expectedErr:    model.ErrUpstreamUnavailable,
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "other error",
+			err:            &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadGateway}},
+			expectedErr:    model.ErrFetch,
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewGithubService(*config.GetDefault(), github.NewClient(nil), rate.NewLimiter(rate.Every(time.Hour), 10), storage.NewNoopStorage())
+
+			err := svc.HandleRequestErrors(tt.err)
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.ErrorIs(t, err, tt.err)
+
+			problem := model.NewProblem(err, "/repos", "request-id")
+			assert.Equal(t, tt.expectedStatus, problem.Status)
+			assert.Equal(t, tt.expectedErr.Error(), problem.Code)
+			assert.Equal(t, tt.expectedRetryAfter, problem.RetryAfter)
+			assert.Equal(t, "request-id", problem.RequestID)
+		})
+	}
+}
+
+// TestRateLimitReached checks that the delay until the next tokens is given as retry hint
+func TestRateLimitReached(t *testing.T) {
+	mockedRateLimiter := rate.NewLimiter(rate.Every(time.Minute), 2)
+	mockedRateLimiter.AllowN(time.Now(), 2)
+
+	svc := NewGithubService(*config.GetDefault(), github.NewClient(nil), mockedRateLimiter, storage.NewNoopStorage()).(githubService)
+
+	problem := model.NewProblem(rateLimitReached(svc.githubRateLimiter, 1), "/repos", "")
+	assert.Equal(t, http.StatusTooManyRequests, problem.Status)
+	assert.InDelta(t, 60, problem.RetryAfter, 1)
+
+	// checking the delay must not consume tokens
+	assert.InDelta(t, 0, mockedRateLimiter.Tokens(), 0.01)
+}
+
+// TestWrapTransport checks that the wrapped clients keep the URLs and the user agent of the client given
+func TestWrapTransport(t *testing.T) {
+	githubClient, err := github.NewClient(nil).WithEnterpriseURLs("https://github.example.com/api/v3/", "https://github.example.com/api/uploads/")
+	assert.NoError(t, err)
+	githubClient.UserAgent = "sclng-backend"
+
+	svc := NewGithubService(*config.GetDefault(), githubClient, rate.NewLimiter(rate.Every(time.Hour), 10), storage.NewNoopStorage()).(githubService)
+
+	for _, client := range []*github.Client{svc.githubClient, svc.eventsClient} {
+		assert.Equal(t, githubClient.BaseURL, client.BaseURL)
+		assert.Equal(t, githubClient.UploadURL, client.UploadURL)
+		assert.Equal(t, "sclng-backend", client.UserAgent)
+	}
+}
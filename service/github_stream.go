@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+)
+
+// StreamLastHundredRepositories works like FetchLastHundredRepositories, but each repository is sent to emit
+// as soon as its languages are loaded, instead of waiting for the slowest request. Repositories are sent in the order
+// languages arrive, not in creation order. The last event is a summary with errors and the rate limit state.
+// An error is returned only if nothing has been sent yet, so the caller can still answer with an error status.
+// If the context is done, remaining repositories are sent without languages and their tokens given back
+func (s githubService) StreamLastHundredRepositories(ctx context.Context, seachQuery model.SearchQuery, emit func(model.StreamEvent)) error {
+	summary := model.StreamSummary{
+		Errors: make([]model.RepositoryError, 0),
+	}
+
+	// With the events source, languages are already loaded, so everything is sent at once
+	if s.config.Github.Source == config.GithubSourceEvents {
+		repos, err := s.FetchRepositoriesFromEvents(seachQuery)
+		if err != nil {
+			return err
+		}
+
+		for i := range repos {
+			emit(model.StreamEvent{Type: model.StreamEventRepository, Repository: &repos[i]})
+		}
+
+		summary.Count = len(repos)
+		summary.RateLimit = s.RateLimitState()
+		emit(model.StreamEvent{Type: model.StreamEventSummary, Summary: &summary})
+
+		return nil
+	}
+
+	repos, err := s.SearchRepositories(ctx, seachQuery)
+	if err != nil {
+		return err
+	}
+
+	reservation, err := s.reserveLanguagesTokens(ctx, repos)
+	if err != nil {
+		return err
+	}
+
+	positions := make(map[int64]int, len(repos))
+	for i, r := range repos {
+		positions[r.ID] = i
+	}
+
+	skipped := 0
+
+	for result := range s.LoadRepositoriesLanguages(ctx, repos) {
+		i := positions[result.RepositoryID]
+
+		if result.Skipped {
+			skipped += 1
+		}
+
+		if result.Error != nil {
+			summary.Errors = append(summary.Errors, model.RepositoryError{FullName: repos[i].FullName, Code: result.Error.Error()})
+		} else {
+			repos[i].Languages = result.Languages
+		}
+
+		repo := repos[i]
+		emit(model.StreamEvent{Type: model.StreamEventRepository, Repository: &repo})
+	}
+
+	reservation.giveBack(skipped)
+	s.SaveRepositories(repos)
+
+	summary.Count = len(repos)
+	summary.RateLimit = s.RateLimitState()
+	emit(model.StreamEvent{Type: model.StreamEventSummary, Summary: &summary})
+
+	return nil
+}
+
+// RateLimitState returns the number of requests still available in the local rate limiter
+func (s githubService) RateLimitState() model.RateLimitState {
+	return model.RateLimitState{
+		Limit:     s.githubRateLimiter.Burst(),
+		Remaining: int(s.githubRateLimiter.TokensAt(time.Now())),
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	"github.com/google/go-github/v66/github"
+	githubMock "github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+// TestStreamLastHundredRepositories will test function StreamLastHundredRepositories
+func TestStreamLastHundredRepositories(t *testing.T) {
+	mockedHTTPClient := githubMock.NewMockedHTTPClient(
+		githubMock.WithRequestMatch(
+			githubMock.GetSearchRepositories,
+			github.RepositoriesSearchResult{
+				Repositories: []*github.Repository{
+					{ID: github.Int64(1), FullName: github.String("owner1/repo1"), Owner: &github.User{Login: github.String("owner1")}, Name: github.String("repo1"), Language: github.String("Go")},
+					{ID: github.Int64(2), FullName: github.String("owner2/repo2"), Owner: &github.User{Login: github.String("owner2")}, Name: github.String("repo2"), Language: github.String("Java")},
+					{ID: github.Int64(3), FullName: github.String("owner3/repo3"), Owner: &github.User{Login: github.String("owner3")}, Name: github.String("repo3")},
+				},
+			},
+		),
+		githubMock.WithRequestMatchHandler(
+			githubMock.GetReposLanguagesByOwnerByRepo,
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// languages of the second repository can't be loaded
+				if strings.Contains(r.URL.Path, "repo2") {
+					githubMock.WriteError(w, http.StatusInternalServerError, "unexpected error")
+					return
+				}
+
+				_, err := w.Write(githubMock.MustMarshal(map[string]int{"Go": 10}))
+
+				if err != nil {
+					t.Error("unable to configure mock http client")
+				}
+			}),
+		),
+	)
+
+	mockedRateLimiter := rate.NewLimiter(rate.Every(time.Hour), 60)
+	conf := config.GetDefault()
+	conf.Github.MaxAttempts = 1 // retries are tested in TestCallWithRetry
+	svc := NewGithubService(*conf, github.NewClient(mockedHTTPClient), mockedRateLimiter, storage.NewNoopStorage())
+
+	events := make([]model.StreamEvent, 0)
+	err := svc.StreamLastHundredRepositories(context.Background(), model.SearchQuery{}, func(event model.StreamEvent) {
+		events = append(events, event)
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, events, 4)
+
+	languages := make(map[string]map[string]int)
+	for _, event := range events[:3] {
+		assert.Equal(t, model.StreamEventRepository, event.Type)
+		languages[event.Repository.FullName] = event.Repository.Languages
+	}
+
+	assert.Equal(t, map[string]map[string]int{
+		"owner1/repo1": {"Go": 10},
+		"owner2/repo2": nil,
+		"owner3/repo3": {},
+	}, languages)
+
+	summary := events[3]
+	assert.Equal(t, model.StreamEventSummary, summary.Type)
+	assert.Equal(t, 3, summary.Summary.Count)
+	assert.Equal(t, []model.RepositoryError{{FullName: "owner2/repo2", Code: "FETCH_ERROR"}}, summary.Summary.Errors)
+	assert.Equal(t, 60, summary.Summary.RateLimit.Limit)
+	assert.Equal(t, 57, summary.Summary.RateLimit.Remaining)
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// tokensReservation keeps the tokens consumed from the rate limiters for requests not sent yet,
+// so the tokens of requests finally not sent can be given back.
+// Tokens are counted as reserved in the quota tracker until giveBack is called
+type tokensReservation struct {
+	limiters     []*rate.Limiter
+	reservations []*rate.Reservation
+	client       *apiClient
+	reserved     *atomic.Int64
+	reservedAt   time.Time
+	tokens       int
+}
+
+// reserveTokens consumes n tokens from the rate limiters, only if they are all available now.
+// When the request is made with an API key, tokens are first taken from the share of the key,
+// then from the priority lane of the request if lanes are enabled, and finally from the Github rate limiter.
+// Returns CLIENT_QUOTA_REACHED or RATE_LIMIT_REACHED if there are not enough tokens
+func (s githubService) reserveTokens(ctx context.Context, n int) (*tokensReservation, error) {
+	reservedAt := time.Now()
+
+	client := apiClientFromContext(ctx)
+	limiters := make([]*rate.Limiter, 0, 3)
+
+	if client != nil {
+		limiters = append(limiters, client.limiter)
+	}
+
+	if lane := s.lanes.limiter(ctx, n, reservedAt); lane != nil {
+		limiters = append(limiters, lane)
+	}
+
+	limiters = append(limiters, s.githubRateLimiter)
+	reservations := make([]*rate.Reservation, 0, len(limiters))
+
+	for _, limiter := range limiters {
+		// Tokens are checked before reserving, because cancelling a reservation made with a delay
+		// doesn't restore all tokens of the reservations made before it
+		var reservation *rate.Reservation
+		if limiter.TokensAt(reservedAt) >= float64(n) {
+			reservation = limiter.ReserveN(reservedAt, n)
+		}
+
+		// The reservation must be cancelled at the time it was made, otherwise tokens are not restored
+		if reservation == nil || !reservation.OK() || reservation.DelayFrom(reservedAt) > 0 {
+			if reservation != nil {
+				reservation.CancelAt(reservedAt)
+			}
+
+			for _, previous := range reservations {
+				previous.CancelAt(reservedAt)
+			}
+
+			if client != nil && limiter == client.limiter {
+				return nil, model.ErrClientQuotaReached.WithRetryAfter(limitDelay(limiter, n))
+			}
+
+			return nil, rateLimitReached(limiter, n)
+		}
+
+		reservations = append(reservations, reservation)
+	}
+
+	s.quota.reserved.Add(int64(n))
+
+	if client != nil {
+		client.githubRequests.Add(int64(n))
+	}
+
+	return &tokensReservation{
+		limiters:     limiters,
+		reservations: reservations,
+		client:       client,
+		reserved:     &s.quota.reserved,
+		reservedAt:   reservedAt,
+		tokens:       n,
+	}, nil
+}
+
+// allowTokens consumes n tokens for requests sent right away, see reserveTokens
+func (s githubService) allowTokens(ctx context.Context, n int) error {
+	reservation, err := s.reserveTokens(ctx, n)
+	reservation.giveBack(0)
+
+	return err
+}
+
+// availableTokens returns the number of tokens available in all the rate limiters used for the request
+func (s githubService) availableTokens(ctx context.Context) int {
+	available := int(s.githubRateLimiter.Tokens())
+
+	if client := apiClientFromContext(ctx); client != nil {
+		available = min(available, int(client.limiter.Tokens()))
+	}
+
+	if lane, enabled := s.lanes.available(ctx); enabled {
+		available = min(available, lane)
+	}
+
+	return max(available, 0)
+}
+
+// giveBack ends the reservation once all requests are done, and gives back the tokens reserved for requests finally not sent.
+// The whole reservation is cancelled, then the tokens really used are consumed again, even if it makes the limiter wait for the next ones
+func (r *tokensReservation) giveBack(unused int) {
+	if r == nil {
+		return
+	}
+
+	r.reserved.Add(-int64(r.tokens))
+
+	if unused <= 0 {
+		return
+	}
+
+	used := r.tokens - unused
+
+	for i, limiter := range r.limiters {
+		r.reservations[i].CancelAt(r.reservedAt)
+
+		if used > 0 {
+			limiter.ReserveN(time.Now(), used)
+		}
+	}
+
+	if r.client != nil {
+		r.client.githubRequests.Add(-int64(unused))
+	}
+
+	log.WithFields(log.Fields{
+		"reserved": r.tokens,
+		"unused":   unused,
+	}).Debug("rate limiter tokens not used given back")
+}
+
+// upstreamContext returns the context to use for a single call to Github, with the configured timeout
+func (s githubService) upstreamContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.config.Github.RequestTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, time.Duration(s.config.Github.RequestTimeout)*time.Second)
+}
+
+// contextError converts the error of a context done to an API error
+func contextError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return model.ErrRequestTimeout.Wrap(err)
+	}
+
+	return model.ErrRequestCanceled.Wrap(err)
+}
+
+// rateLimitReached returns the RATE_LIMIT_REACHED error, with the delay until n tokens are available again in the limiter
+func rateLimitReached(limiter *rate.Limiter, n int) error {
+	return model.ErrRateLimitReached.WithRetryAfter(limitDelay(limiter, n))
+}
+
+// limitDelay returns the delay until n tokens are available again in the limiter, 0 if they will never be.
+// It's computed without reserving, because cancelling a reservation doesn't always restore all tokens
+func limitDelay(limiter *rate.Limiter, n int) time.Duration {
+	missing := float64(n) - limiter.TokensAt(time.Now())
+
+	if missing <= 0 || n > limiter.Burst() || limiter.Limit() <= 0 {
+		return 0
+	}
+
+	return time.Duration(missing / float64(limiter.Limit()) * float64(time.Second))
+}
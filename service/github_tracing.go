@@ -0,0 +1,46 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Scalingo/sclng-backend-test-v1/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracingTransport creates a client span for every call sent to Github, with the status and the remaining quota.
+// The trace context is not propagated in the request headers, Github is a third party which must not receive our trace IDs
+type tracingTransport struct {
+	base http.RoundTripper
+}
+
+func (t tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	_, span := tracing.StartWithKind(req.Context(), "github "+githubEndpoint(req.URL.Path), trace.SpanKindClient,
+		attribute.String("http.request.method", req.Method),
+		attribute.String("url.path", req.URL.Path),
+	)
+
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		tracing.End(span, err)
+		return res, err
+	}
+
+	span.SetAttributes(attribute.Int("http.response.status_code", res.StatusCode))
+
+	if res.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, http.StatusText(res.StatusCode))
+	}
+
+	if remaining, convErr := strconv.Atoi(res.Header.Get("X-RateLimit-Remaining")); convErr == nil {
+		span.SetAttributes(
+			attribute.String("github.ratelimit.resource", res.Header.Get("X-RateLimit-Resource")),
+			attribute.Int("github.ratelimit.remaining", remaining),
+		)
+	}
+
+	tracing.End(span, nil)
+	return res, err
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	"github.com/google/go-github/v66/github"
+	githubMock "github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"golang.org/x/time/rate"
+)
+
+// TestFetchLastHundredRepositoriesSpans checks that the search and each languages call are children
+// of the FetchLastHundredRepositories span, and that the trace context is not sent to Github
+func TestFetchLastHundredRepositoriesSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	traceparents := make(chan string, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents <- r.Header.Get("traceparent")
+
+		if r.URL.Path == "/search/repositories" {
+			_, _ = w.Write(githubMock.MustMarshal(github.RepositoriesSearchResult{
+				Repositories: []*github.Repository{
+					{ID: github.Int64(1), FullName: github.String("owner1/repo1"), Owner: &github.User{Login: github.String("owner1")}, Name: github.String("repo1"), Language: github.String("Go")},
+					{ID: github.Int64(2), FullName: github.String("owner2/repo2"), Owner: &github.User{Login: github.String("owner2")}, Name: github.String("repo2"), Language: github.String("Go")},
+				},
+			}))
+
+			return
+		}
+
+		_, _ = w.Write(githubMock.MustMarshal(map[string]int{"Go": 100}))
+	}))
+
+	defer server.Close()
+
+	githubClient := github.NewClient(server.Client())
+	githubClient.BaseURL, _ = url.Parse(server.URL + "/")
+
+	svc := NewGithubService(*config.GetDefault(), githubClient, rate.NewLimiter(rate.Every(time.Hour), 10), storage.NewNoopStorage())
+
+	_, err := svc.FetchLastHundredRepositories(context.Background(), model.SearchQuery{Language: "Go"})
+	assert.NoError(t, err)
+
+	spans := map[string][]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = append(spans[span.Name()], span)
+	}
+
+	assert.Len(t, spans["FetchLastHundredRepositories"], 1)
+	assert.Len(t, spans["SearchRepositories"], 1)
+	assert.Len(t, spans["FetchLanguagesForSingleRepository"], 2)
+	assert.Len(t, spans["github search"], 1)
+	assert.Len(t, spans["github languages"], 2)
+
+	root := spans["FetchLastHundredRepositories"][0].SpanContext()
+	assert.Equal(t, root.SpanID(), spans["SearchRepositories"][0].Parent().SpanID())
+
+	for _, span := range spans["FetchLanguagesForSingleRepository"] {
+		assert.Equal(t, root.SpanID(), span.Parent().SpanID())
+	}
+
+	close(traceparents)
+	for traceparent := range traceparents {
+		assert.Empty(t, traceparent)
+	}
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+type HealthService interface {
+	Readiness(ctx context.Context) model.Readiness
+}
+
+type healthService struct {
+	githubService GithubService
+	storage       storage.Storage
+	configErr     error
+	githubCheck   *githubCheckCache
+	config        config.Config
+}
+
+// githubCheckCache keeps the last check of Github, so frequent probes don't call Github each time.
+// The lock is never held during the call, probes received while a check is running get the last result
+type githubCheckCache struct {
+	mu        sync.Mutex
+	checking  bool
+	buckets   map[string]model.QuotaBucket
+	err       error
+	checkedAt time.Time
+}
+
+// NewHealthService will create an instance of HealthService.
+// configErr is the error returned when loading the configuration, nil if it has been loaded cleanly.
+// Invalid configurations stop the service at startup, so it's only set when no config file is found
+// and the default values are used
+func NewHealthService(config config.Config, githubService GithubService, storage storage.Storage, configErr error) HealthService {
+	return healthService{
+		githubService: githubService,
+		storage:       storage,
+		configErr:     configErr,
+		githubCheck:   &githubCheckCache{},
+		config:        config,
+	}
+}
+
+// Readiness checks all dependencies required to serve /repos.
+// The service is not ready if the rate limiter is not synchronized yet, Github is unreachable,
+// the core quota is exhausted, the circuit breaker is open or the storage is failing.
+// A missing configuration file and the cache are reported but never make the service not ready
+func (s healthService) Readiness(ctx context.Context) model.Readiness {
+	checks := model.ReadinessChecks{
+		Config:         s.checkConfig(),
+		RateLimiter:    s.checkRateLimiter(),
+		Github:         s.checkGithub(ctx),
+		CircuitBreaker: s.checkCircuitBreaker(),
+		Storage:        s.checkStorage(),
+		Cache:          model.CacheHealth{HealthCheck: model.HealthCheck{Status: model.HealthStatusOK}, Entries: s.githubService.CacheEntries()},
+	}
+
+	ready := checks.Config.Status != model.HealthStatusFailing &&
+		checks.RateLimiter.Status == model.HealthStatusOK &&
+		checks.Github.Status == model.HealthStatusOK &&
+		checks.CircuitBreaker.Status == model.HealthStatusOK &&
+		checks.Storage.Status != model.HealthStatusFailing
+
+	return model.Readiness{Ready: ready, Checks: checks}
+}
+
+// checkConfig reports a missing config file as a warning, the default values have been validated at startup
+func (s healthService) checkConfig() model.HealthCheck {
+	if errors.Is(s.configErr, config.ErrConfigNotFound) {
+		return model.HealthCheck{Status: model.HealthStatusWarning, Error: s.configErr.Error()}
+	}
+
+	if s.configErr != nil {
+		return model.HealthCheck{Status: model.HealthStatusFailing, Error: s.configErr.Error()}
+	}
+
+	return model.HealthCheck{Status: model.HealthStatusOK}
+}
+
+// checkRateLimiter reports if the local rate limiter has been synchronized with the quota reported by Github at startup
+func (s healthService) checkRateLimiter() model.HealthCheck {
+	if !s.githubService.RateLimiterReady() {
+		return model.HealthCheck{Status: model.HealthStatusFailing, Error: "waiting for the current rate limits from github"}
+	}
+
+	return model.HealthCheck{Status: model.HealthStatusOK}
+}
+
+// checkGithub loads the quota from Github, at most once per configured interval.
+// Only the core bucket is required: the search one is reset every minute, and cached results can still be served meanwhile
+func (s healthService) checkGithub(ctx context.Context) model.GithubHealth {
+	buckets, checkedAt, err := s.githubQuota(ctx)
+
+	health := model.GithubHealth{
+		HealthCheck:      model.HealthCheck{Status: model.HealthStatusOK},
+		CheckedAt:        checkedAt,
+		Buckets:          buckets,
+		LocalRateLimiter: s.githubService.RateLimitState(),
+	}
+
+	if err != nil {
+		health.Status = model.HealthStatusFailing
+		health.Error = err.Error()
+
+		return health
+	}
+
+	if core, found := buckets["core"]; found && core.Remaining <= 0 {
+		health.Status = model.HealthStatusFailing
+		health.Error = fmt.Sprintf("core quota exhausted until %s", core.Reset.Format(time.RFC3339))
+	}
+
+	return health
+}
+
+func (s healthService) githubQuota(ctx context.Context) (map[string]model.QuotaBucket, time.Time, error) {
+	check := s.githubCheck
+	check.mu.Lock()
+
+	fresh := time.Since(check.checkedAt) < time.Duration(s.config.Health.GithubCheckInterval)*time.Second
+	if fresh || (check.checking && !check.checkedAt.IsZero()) {
+		defer check.mu.Unlock()
+		return check.buckets, check.checkedAt, check.err
+	}
+
+	check.checking = true
+	check.mu.Unlock()
+
+	buckets, err := s.githubService.GithubQuota(ctx)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Warning("github is not reachable for readiness check")
+	}
+
+	check.mu.Lock()
+	defer check.mu.Unlock()
+
+	check.checking = false
+	check.buckets = buckets
+	check.err = err
+	check.checkedAt = time.Now()
+
+	return buckets, check.checkedAt, err
+}
+
+func (s healthService) checkCircuitBreaker() model.CircuitHealth {
+	state := s.githubService.CircuitBreakerState()
+
+	if state == CircuitOpen {
+		return model.CircuitHealth{HealthCheck: model.HealthCheck{Status: model.HealthStatusFailing, Error: "calls to github are stopped"}, State: state}
+	}
+
+	return model.CircuitHealth{HealthCheck: model.HealthCheck{Status: model.HealthStatusOK}, State: state}
+}
+
+func (s healthService) checkStorage() model.HealthCheck {
+	if !s.config.Storage.Enabled {
+		return model.HealthCheck{Status: model.HealthStatusDisabled}
+	}
+
+	if err := s.storage.Ping(); err != nil {
+		return model.HealthCheck{Status: model.HealthStatusFailing, Error: err.Error()}
+	}
+
+	return model.HealthCheck{Status: model.HealthStatusOK}
+}
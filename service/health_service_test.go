@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	"github.com/google/go-github/v66/github"
+	githubMock "github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+// TestReadiness will test readiness according to the state of the configuration and the Github quota
+func TestReadiness(t *testing.T) {
+	tests := []struct {
+		name            string
+		configErr       error
+		coreRemaining   int
+		searchRemaining int
+		expectedReady   bool
+		expectedFailing string
+	}{
+		{
+			name:            "ready",
+			coreRemaining:   4990,
+			searchRemaining: 30,
+			expectedReady:   true,
+		},
+		{
+			name:            "search quota exhausted",
+			coreRemaining:   4990,
+			searchRemaining: 0,
+			expectedReady:   true,
+		},
+		{
+			name:            "core quota exhausted",
+			coreRemaining:   0,
+			searchRemaining: 30,
+			expectedReady:   false,
+			expectedFailing: "github",
+		},
+		{
+			name:            "config file not found",
+			configErr:       config.ErrConfigNotFound,
+			coreRemaining:   4990,
+			searchRemaining: 30,
+			expectedReady:   true,
+		},
+		{
+			name:            "invalid configuration",
+			configErr:       errors.New("invalid config file"),
+			coreRemaining:   4990,
+			searchRemaining: 30,
+			expectedReady:   false,
+			expectedFailing: "config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				calls.Add(1)
+
+				_, _ = w.Write(githubMock.MustMarshal(map[string]interface{}{
+					"resources": map[string]interface{}{
+						"core":   github.Rate{Limit: 5000, Remaining: tt.coreRemaining},
+						"search": github.Rate{Limit: 30, Remaining: tt.searchRemaining},
+					},
+				}))
+			}))
+
+			defer server.Close()
+
+			githubClient := github.NewClient(server.Client())
+			githubClient.BaseURL, _ = url.Parse(server.URL + "/")
+
+			conf := config.GetDefault()
+			conf.Storage.Enabled = false
+
+			githubService := NewGithubService(*conf, githubClient, rate.NewLimiter(rate.Every(time.Hour), 10), storage.NewNoopStorage())
+			svc := NewHealthService(*conf, githubService, storage.NewNoopStorage(), tt.configErr)
+
+			assert.False(t, svc.Readiness(context.Background()).Ready, "not ready before the rate limiter bootstrap")
+			githubService.BootstrapRateLimiter(context.Background())
+
+			// the check of Github made before the bootstrap is still used
+			readiness := svc.Readiness(context.Background())
+			assert.Equal(t, tt.expectedReady, readiness.Ready)
+			assert.Equal(t, model.HealthStatusDisabled, readiness.Checks.Storage.Status)
+			assert.Equal(t, tt.coreRemaining, readiness.Checks.Github.Buckets["core"].Remaining)
+			assert.Equal(t, tt.searchRemaining, readiness.Checks.Github.Buckets["search"].Remaining)
+
+			switch tt.expectedFailing {
+			case "github":
+				assert.Equal(t, model.HealthStatusFailing, readiness.Checks.Github.Status)
+			case "config":
+				assert.Equal(t, model.HealthStatusFailing, readiness.Checks.Config.Status)
+			}
+
+			if errors.Is(tt.configErr, config.ErrConfigNotFound) {
+				assert.Equal(t, model.HealthStatusWarning, readiness.Checks.Config.Status)
+			}
+
+			// the last check of Github is reused until the interval is elapsed, only the bootstrap called it again
+			svc.Readiness(context.Background())
+			assert.Equal(t, int32(2), calls.Load())
+		})
+	}
+}
+
+// TestReadinessDuringGithubCheck checks that probes received while Github is checked don't wait, they get the last result
+func TestReadinessDuringGithubCheck(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) > 1 {
+			<-release
+		}
+
+		_, _ = w.Write(githubMock.MustMarshal(map[string]interface{}{
+			"resources": map[string]interface{}{
+				"core": github.Rate{Limit: 5000, Remaining: 4990},
+			},
+		}))
+	}))
+
+	defer server.Close()
+
+	githubClient := github.NewClient(server.Client())
+	githubClient.BaseURL, _ = url.Parse(server.URL + "/")
+
+	conf := config.GetDefault()
+	conf.Storage.Enabled = false
+	conf.Health.GithubCheckInterval = 0
+
+	githubService := NewGithubService(*conf, githubClient, rate.NewLimiter(rate.Every(time.Hour), 10), storage.NewNoopStorage())
+	svc := NewHealthService(*conf, githubService, storage.NewNoopStorage(), nil)
+
+	first := svc.Readiness(context.Background())
+	assert.Equal(t, model.HealthStatusOK, first.Checks.Github.Status)
+
+	done := make(chan struct{})
+	go func() {
+		svc.Readiness(context.Background())
+		close(done)
+	}()
+
+	for calls.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	readiness := svc.Readiness(context.Background())
+	assert.Equal(t, first.Checks.Github.CheckedAt, readiness.Checks.Github.CheckedAt)
+	assert.Equal(t, int32(2), calls.Load())
+
+	close(release)
+	<-done
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// Headers sent with each notification, the signature allows the receiver to check the payload
+// using the shared secret: HMAC-SHA256 of the raw body, hex encoded and prefixed with "sha256="
+const (
+	notificationSignatureHeader = "X-Sclng-Signature-256"
+	notificationEventHeader     = "X-Sclng-Event"
+	notificationDeliveryHeader  = "X-Sclng-Delivery"
+)
+
+type NotificationService interface {
+	Notify(ctx context.Context, event string, data interface{}) error
+	Send(ctx context.Context, notification model.Notification) error
+}
+
+type notificationService struct {
+	httpClient   *http.Client
+	deadLetterMu *sync.Mutex
+	config       config.Config
+}
+
+// NewNotificationService will create an instance of NotificationService
+func NewNotificationService(config config.Config) NotificationService {
+	return notificationService{
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+		deadLetterMu: &sync.Mutex{},
+		config:       config,
+	}
+}
+
+// Notify will build the notification for the event and send it to the configured webhook.
+// If no webhook is configured, notifications are disabled and nothing is sent
+func (s notificationService) Notify(ctx context.Context, event string, data interface{}) error {
+	if s.config.Notifications.WebhookURL == "" {
+		log.WithContext(ctx).WithField("event", event).Debug("no webhook configured. notification skipped")
+		return nil
+	}
+
+	return s.Send(ctx, model.Notification{
+		ID:     newID(),
+		Event:  event,
+		SentAt: time.Now().UTC(),
+		Data:   data,
+	})
+}
+
+// Send will POST the signed notification to the webhook, with retries and an exponential backoff.
+// When all attempts failed, the notification is written to the dead letter log to be replayed manually
+func (s notificationService) Send(ctx context.Context, notification model.Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	backoff := time.Duration(s.config.Notifications.InitialBackoff) * time.Millisecond
+	// the notification is always sent at least once, whatever the configuration
+	maxAttempts := max(s.config.Notifications.MaxAttempts, 1)
+	attempts := 0
+
+	for attempts < maxAttempts {
+		attempts++
+		err = s.post(ctx, notification, body)
+
+		if err == nil {
+			log.WithContext(ctx).WithFields(log.Fields{
+				"event":      notification.Event,
+				"deliveryID": notification.ID,
+				"attempts":   attempts,
+			}).Debug("notification sent to webhook")
+
+			return nil
+		}
+
+		log.WithContext(ctx).WithFields(log.Fields{
+			"event":      notification.Event,
+			"deliveryID": notification.ID,
+			"attempt":    attempts,
+		}).WithError(err).Warning("unable to send notification to webhook")
+
+		if attempts == maxAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			s.writeDeadLetter(notification, attempts, err)
+			return model.ErrNotificationFailed.Wrap(err)
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+
+	s.writeDeadLetter(notification, attempts, err)
+	return model.ErrNotificationFailed.Wrap(err)
+}
+
+// post executes a single delivery attempt. Any status outside the 2xx range is considered as a failure
+func (s notificationService) post(ctx context.Context, notification model.Notification, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.Notifications.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(notificationEventHeader, notification.Event)
+	req.Header.Set(notificationDeliveryHeader, notification.ID)
+	req.Header.Set(notificationSignatureHeader, "sha256="+SignPayload(s.config.Notifications.WebhookSecret, body))
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook answered with status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// writeDeadLetter appends the failed notification to the dead letter log, one JSON object per line
+func (s notificationService) writeDeadLetter(notification model.Notification, attempts int, lastErr error) {
+	s.deadLetterMu.Lock()
+	defer s.deadLetterMu.Unlock()
+
+	logger := log.WithFields(log.Fields{
+		"event":      notification.Event,
+		"deliveryID": notification.ID,
+		"path":       s.config.Notifications.DeadLetterPath,
+	})
+
+	line, err := json.Marshal(model.DeadLetter{
+		Notification: notification,
+		Attempts:     attempts,
+		LastError:    lastErr.Error(),
+		FailedAt:     time.Now().UTC(),
+	})
+
+	if err != nil {
+		logger.WithError(err).Error("unable to encode notification for dead letter log")
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.config.Notifications.DeadLetterPath), 0o750); err != nil {
+		logger.WithError(err).Error("unable to create dead letter log directory")
+		return
+	}
+
+	f, err := os.OpenFile(s.config.Notifications.DeadLetterPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		logger.WithError(err).Error("unable to open dead letter log")
+		return
+	}
+
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		logger.WithError(err).Error("unable to write notification to dead letter log")
+		return
+	}
+
+	logger.Error("notification not delivered after all attempts. written to dead letter log")
+}
+
+// SignPayload returns the hex encoded HMAC-SHA256 of the payload using the secret
+func SignPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newID returns a random identifier, used for deliveries and saved searches
+func newID() string {
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(b)
+}
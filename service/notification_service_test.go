@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNotify will test function Notify against a local webhook receiver
+func TestNotify(t *testing.T) {
+	tests := []struct {
+		name               string
+		failedAttempts     int32
+		maxAttempts        int
+		expectedAttempts   int32
+		expectError        bool
+		expectedDeadLetter bool
+	}{
+		{
+			name:             "Delivered on first attempt",
+			failedAttempts:   0,
+			maxAttempts:      3,
+			expectedAttempts: 1,
+		},
+		{
+			name:             "Delivered after retries",
+			failedAttempts:   2,
+			maxAttempts:      3,
+			expectedAttempts: 3,
+		},
+		{
+			name:               "Not delivered, written to dead letter log",
+			failedAttempts:     5,
+			maxAttempts:        3,
+			expectedAttempts:   3,
+			expectError:        true,
+			expectedDeadLetter: true,
+		},
+		{
+			name:               "Sent once without attempts configured",
+			failedAttempts:     5,
+			maxAttempts:        0,
+			expectedAttempts:   1,
+			expectError:        true,
+			expectedDeadLetter: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Error("unable to read notification body")
+				}
+
+				// signature must match the payload signed with the shared secret
+				assert.Equal(t, "sha256="+SignPayload("secret", body), r.Header.Get(notificationSignatureHeader))
+				assert.Equal(t, "test.event", r.Header.Get(notificationEventHeader))
+
+				if attempts.Add(1) <= tt.failedAttempts {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			defer receiver.Close()
+
+			conf := config.GetDefault()
+			conf.Notifications.WebhookURL = receiver.URL
+			conf.Notifications.WebhookSecret = "secret"
+			conf.Notifications.MaxAttempts = tt.maxAttempts
+			conf.Notifications.InitialBackoff = 1
+			conf.Notifications.DeadLetterPath = filepath.Join(t.TempDir(), "dead-letters.log")
+
+			svc := NewNotificationService(*conf)
+			err := svc.Notify(context.Background(), "test.event", map[string]string{"key": "value"})
+
+			if tt.expectError {
+				assert.EqualError(t, err, "NOTIFICATION_FAILED")
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.expectedAttempts, attempts.Load())
+
+			content, err := os.ReadFile(conf.Notifications.DeadLetterPath)
+
+			if tt.expectedDeadLetter {
+				assert.NoError(t, err)
+
+				var deadLetter model.DeadLetter
+				assert.NoError(t, json.Unmarshal(content, &deadLetter))
+				assert.Equal(t, "test.event", deadLetter.Notification.Event)
+				assert.Equal(t, int(tt.expectedAttempts), deadLetter.Attempts)
+			} else {
+				assert.ErrorIs(t, err, os.ErrNotExist)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	log "github.com/sirupsen/logrus"
+)
+
+type QuotaService interface {
+	Status() model.QuotaStatus
+	RunQuotaAlerts(ctx context.Context)
+}
+
+type quotaService struct {
+	githubService       GithubService
+	notificationService NotificationService
+	config              config.Config
+}
+
+// NewQuotaService will create an instance of QuotaService
+func NewQuotaService(config config.Config, githubService GithubService, notificationService NotificationService) QuotaService {
+	return quotaService{
+		githubService:       githubService,
+		notificationService: notificationService,
+		config:              config,
+	}
+}
+
+// Status returns the view of the service on each Github bucket
+func (s quotaService) Status() model.QuotaStatus {
+	return s.githubService.QuotaStatus()
+}
+
+// RunQuotaAlerts logs and sends to the webhook each alert of a Github bucket crossing its low-water mark,
+// until the context is done
+func (s quotaService) RunQuotaAlerts(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case alert := <-s.githubService.QuotaAlerts():
+			s.sendAlert(ctx, alert)
+		}
+	}
+}
+
+func (s quotaService) sendAlert(ctx context.Context, alert model.QuotaAlert) {
+	logger := log.WithContext(ctx).WithFields(log.Fields{
+		"bucket":       alert.Bucket,
+		"remaining":    alert.Remaining,
+		"lowWaterMark": alert.LowWaterMark,
+		"reset":        alert.Reset,
+	})
+
+	if alert.Event == QuotaLowEvent {
+		logger.Warning("github quota is low. /repos will be served from cache only until the reset")
+	} else {
+		logger.Info("github quota is above the low-water mark again")
+	}
+
+	// failures are already logged and written to the dead letter log by the notification service
+	_ = s.notificationService.Notify(ctx, alert.Event, alert)
+}
@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+// Event sent to the webhook when new repositories match a saved search
+const SavedSearchNewRepositoriesEvent = "saved_search.new_repositories"
+
+type SearchesService interface {
+	CreateSearch(search model.SavedSearch) (model.SavedSearch, error)
+	GetSearch(id string) (model.SavedSearch, error)
+	ListSearches() ([]model.SavedSearch, error)
+	UpdateSearch(id string, search model.SavedSearch) (model.SavedSearch, error)
+	DeleteSearch(id string) error
+
+	RunSavedSearches(ctx context.Context)
+	RunSavedSearch(ctx context.Context, search model.SavedSearch) ([]model.GithubRepository, error)
+}
+
+type searchesService struct {
+	githubService       GithubService
+	notificationService NotificationService
+	storage             storage.Storage
+	config              config.Config
+}
+
+// NewSearchesService will create an instance of SearchesService
+func NewSearchesService(config config.Config, githubService GithubService, notificationService NotificationService, storage storage.Storage) SearchesService {
+	return searchesService{
+		githubService:       githubService,
+		notificationService: notificationService,
+		storage:             storage,
+		config:              config,
+	}
+}
+
+// CreateSearch will save a new search, it will be executed at the next scheduler run
+func (s searchesService) CreateSearch(search model.SavedSearch) (model.SavedSearch, error) {
+	if err := s.validateSearch(search); err != nil {
+		return model.SavedSearch{}, err
+	}
+
+	now := time.Now().UTC()
+	search.ID = newID()
+	search.CreatedAt = now
+	search.UpdatedAt = now
+	search.LastRunAt = nil
+
+	if err := s.storage.SaveSearch(search); err != nil {
+		return model.SavedSearch{}, s.handleStorageErrors(err)
+	}
+
+	return search, nil
+}
+
+// GetSearch returns a saved search using its ID
+func (s searchesService) GetSearch(id string) (model.SavedSearch, error) {
+	if !s.config.Storage.Enabled {
+		return model.SavedSearch{}, model.ErrStorageDisabled
+	}
+
+	search, err := s.storage.GetSearch(id)
+	if err != nil {
+		return model.SavedSearch{}, s.handleStorageErrors(err)
+	}
+
+	return search, nil
+}
+
+// ListSearches returns all saved searches
+func (s searchesService) ListSearches() ([]model.SavedSearch, error) {
+	if !s.config.Storage.Enabled {
+		return []model.SavedSearch{}, model.ErrStorageDisabled
+	}
+
+	searches, err := s.storage.ListSearches()
+	if err != nil {
+		return []model.SavedSearch{}, s.handleStorageErrors(err)
+	}
+
+	return searches, nil
+}
+
+// UpdateSearch will replace the name and query of a saved search.
+// If the query changes, the next run is considered as the first one, so repositories
+// already matching the new filters are not notified
+func (s searchesService) UpdateSearch(id string, search model.SavedSearch) (model.SavedSearch, error) {
+	if err := s.validateSearch(search); err != nil {
+		return model.SavedSearch{}, err
+	}
+
+	existing, err := s.storage.GetSearch(id)
+	if err != nil {
+		return model.SavedSearch{}, s.handleStorageErrors(err)
+	}
+
+	if existing.Query != search.Query {
+		existing.LastRunAt = nil
+	}
+
+	existing.Name = search.Name
+	existing.Query = search.Query
+	existing.UpdatedAt = time.Now().UTC()
+
+	if err := s.storage.SaveSearch(existing); err != nil {
+		return model.SavedSearch{}, s.handleStorageErrors(err)
+	}
+
+	return existing, nil
+}
+
+// DeleteSearch will delete a saved search, it won't be executed anymore
+func (s searchesService) DeleteSearch(id string) error {
+	if !s.config.Storage.Enabled {
+		return model.ErrStorageDisabled
+	}
+
+	if err := s.storage.DeleteSearch(id); err != nil {
+		return s.handleStorageErrors(err)
+	}
+
+	return nil
+}
+
+// RunSavedSearches will execute all saved searches at each interval, until the context is cancelled.
+// Searches are executed one after the other to limit the number of requests made at the same time to Github
+func (s searchesService) RunSavedSearches(ctx context.Context) {
+	interval := time.Duration(s.config.Searches.RunInterval) * time.Second
+	log.WithContext(ctx).WithField("interval", interval).Info("start running saved searches")
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.WithContext(ctx).Info("stop running saved searches")
+			return
+		case <-time.After(interval):
+		}
+
+		searches, err := s.storage.ListSearches()
+		if err != nil {
+			log.WithContext(ctx).WithError(err).Error("unable to list saved searches")
+			continue
+		}
+
+		for _, search := range searches {
+			if _, err := s.RunSavedSearch(ctx, search); err != nil {
+				log.WithContext(ctx).WithField("searchID", search.ID).WithError(err).Error("unable to run saved search")
+			}
+		}
+	}
+}
+
+// RunSavedSearch will execute a saved search and notify the webhook with the repositories never seen before.
+// On the first run, repositories found are only marked as seen, to not notify the whole current result.
+// Languages are only loaded for the new repositories, the ones already seen are not notified.
+// Returns the new repositories found
+func (s searchesService) RunSavedSearch(ctx context.Context, search model.SavedSearch) ([]model.GithubRepository, error) {
+	repos, err := s.searchRepositories(ctx, search.Query)
+	if err != nil {
+		return []model.GithubRepository{}, err
+	}
+
+	repositoryIDs := make([]int64, 0, len(repos))
+	for _, r := range repos {
+		repositoryIDs = append(repositoryIDs, r.ID)
+	}
+
+	unseenIDs, err := s.storage.UnseenRepositories(search.ID, repositoryIDs)
+	if err != nil {
+		return []model.GithubRepository{}, s.handleStorageErrors(err)
+	}
+
+	unseen := make(map[int64]bool, len(unseenIDs))
+	for _, id := range unseenIDs {
+		unseen[id] = true
+	}
+
+	newRepos := make([]model.GithubRepository, 0, len(unseenIDs))
+	for _, r := range repos {
+		if unseen[r.ID] {
+			newRepos = append(newRepos, r)
+		}
+	}
+
+	// Repositories are marked as seen once their languages are loaded, to notify them at the next run on failure
+	if search.LastRunAt != nil && len(newRepos) > 0 && s.config.Github.Source != config.GithubSourceEvents {
+		newRepos, err = s.githubService.FetchRepositoriesLanguages(ctx, newRepos)
+		if err != nil {
+			return []model.GithubRepository{}, err
+		}
+	}
+
+	if _, err := s.storage.MarkRepositoriesSeen(search.ID, repositoryIDs, time.Now()); err != nil {
+		return []model.GithubRepository{}, s.handleStorageErrors(err)
+	}
+
+	if err := s.storage.MarkSearchRun(search.ID, time.Now().UTC()); err != nil {
+		return []model.GithubRepository{}, s.handleStorageErrors(err)
+	}
+
+	log.WithContext(ctx).WithFields(log.Fields{
+		"searchID":             search.ID,
+		"firstRun":             search.LastRunAt == nil,
+		"numberOfRepositories": len(newRepos),
+	}).Debug("saved search executed")
+
+	if search.LastRunAt == nil || len(newRepos) == 0 {
+		return newRepos, nil
+	}
+
+	err = s.notificationService.Notify(ctx, SavedSearchNewRepositoriesEvent, model.SavedSearchNotification{
+		Search:       search,
+		Repositories: newRepos,
+	})
+
+	return newRepos, err
+}
+
+// searchRepositories returns the repositories matching the saved search. With the search source, their languages are not loaded
+func (s searchesService) searchRepositories(ctx context.Context, query model.SearchQuery) ([]model.GithubRepository, error) {
+	// With the events source, repositories are already loaded with their languages, no request to Github is made
+	if s.config.Github.Source == config.GithubSourceEvents {
+		return s.githubService.FetchRepositoriesFromEvents(query)
+	}
+
+	return s.githubService.SearchRepositories(ctx, query)
+}
+
+// validateSearch checks that the search can be saved and executed with the current configuration
+func (s searchesService) validateSearch(search model.SavedSearch) error {
+	if !s.config.Storage.Enabled {
+		return model.ErrStorageDisabled
+	}
+
+	if search.Query.License != "" && s.config.Github.Source == config.GithubSourceEvents {
+		return model.ErrFilterNotSupported
+	}
+
+	return nil
+}
+
+// handleStorageErrors converts errors returned by the storage to API errors
+func (s searchesService) handleStorageErrors(err error) error {
+	if errors.Is(err, storage.ErrSavedSearchNotFound) {
+		return model.ErrSavedSearchNotFound.Wrap(err)
+	}
+
+	log.WithError(err).Error("unable to access saved searches in storage")
+	return model.ErrStorage.Wrap(err)
+}
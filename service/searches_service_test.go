@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	"github.com/google/go-github/v66/github"
+	githubMock "github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+// TestRunSavedSearch will test function RunSavedSearch with a local webhook receiver
+func TestRunSavedSearch(t *testing.T) {
+	firstResult := github.RepositoriesSearchResult{
+		Repositories: []*github.Repository{
+			{ID: github.Int64(1), FullName: github.String("owner1/repo1"), Owner: &github.User{Login: github.String("owner1")}, Name: github.String("repo1"), Language: github.String("Go")},
+		},
+	}
+
+	secondResult := github.RepositoriesSearchResult{
+		Repositories: []*github.Repository{
+			{ID: github.Int64(2), FullName: github.String("owner2/repo2"), Owner: &github.User{Login: github.String("owner2")}, Name: github.String("repo2"), Language: github.String("Go")},
+			{ID: github.Int64(1), FullName: github.String("owner1/repo1"), Owner: &github.User{Login: github.String("owner1")}, Name: github.String("repo1"), Language: github.String("Go")},
+		},
+	}
+
+	// languages must only be loaded for the new repository of the second run
+	var languagesRequested []string
+
+	mockedHTTPClient := githubMock.NewMockedHTTPClient(
+		githubMock.WithRequestMatch(githubMock.GetSearchRepositories, firstResult, secondResult),
+		githubMock.WithRequestMatchHandler(
+			githubMock.GetReposLanguagesByOwnerByRepo,
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				languagesRequested = append(languagesRequested, r.URL.Path)
+				_, _ = w.Write(githubMock.MustMarshal(map[string]int{"Go": 100}))
+			}),
+		),
+	)
+
+	// local webhook receiver, keeping the notifications received
+	notifications := make(chan model.Notification, 2)
+	var received atomic.Int32
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "sha256="+SignPayload("secret", body), r.Header.Get(notificationSignatureHeader))
+
+		var notification model.Notification
+		assert.NoError(t, json.Unmarshal(body, &notification))
+
+		received.Add(1)
+		notifications <- notification
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	defer receiver.Close()
+
+	conf := config.GetDefault()
+	conf.Storage.Path = filepath.Join(t.TempDir(), "storage.db")
+	conf.Notifications.WebhookURL = receiver.URL
+	conf.Notifications.WebhookSecret = "secret"
+
+	store, err := storage.NewBoltStorage(conf.Storage)
+	if err != nil {
+		t.Fatalf("unable to open storage: %v", err)
+	}
+
+	defer store.Close()
+
+	mockedRateLimiter := rate.NewLimiter(rate.Every(time.Hour), 60)
+	githubService := NewGithubService(*conf, github.NewClient(mockedHTTPClient), mockedRateLimiter, store)
+	svc := NewSearchesService(*conf, githubService, NewNotificationService(*conf), store)
+
+	search, err := svc.CreateSearch(model.SavedSearch{Name: "Go with MIT", Query: model.SearchQuery{Language: "Go", License: "mit"}})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, search.ID)
+
+	searches, err := svc.ListSearches()
+	assert.NoError(t, err)
+	assert.Len(t, searches, 1)
+
+	// first run: repositories are only marked as seen
+	newRepos, err := svc.RunSavedSearch(context.Background(), search)
+	assert.NoError(t, err)
+	assert.Len(t, newRepos, 1)
+	assert.Equal(t, int32(0), received.Load())
+
+	// second run: only the new repository is notified
+	search, err = svc.GetSearch(search.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, search.LastRunAt)
+
+	newRepos, err = svc.RunSavedSearch(context.Background(), search)
+	assert.NoError(t, err)
+	assert.Len(t, newRepos, 1)
+	assert.Equal(t, int32(1), received.Load())
+
+	notification := <-notifications
+	assert.Equal(t, SavedSearchNewRepositoriesEvent, notification.Event)
+
+	data, _ := json.Marshal(notification.Data)
+	var payload model.SavedSearchNotification
+	assert.NoError(t, json.Unmarshal(data, &payload))
+	assert.Equal(t, search.ID, payload.Search.ID)
+	assert.Len(t, payload.Repositories, 1)
+	assert.Equal(t, "owner2/repo2", payload.Repositories[0].FullName)
+	assert.Equal(t, map[string]int{"Go": 100}, payload.Repositories[0].Languages)
+	assert.Equal(t, []string{"/repos/owner2/repo2/languages"}, languagesRequested)
+
+	// update and delete
+	search, err = svc.UpdateSearch(search.ID, model.SavedSearch{Name: "Only Go", Query: model.SearchQuery{Language: "Go"}})
+	assert.NoError(t, err)
+	assert.Nil(t, search.LastRunAt)
+
+	assert.NoError(t, svc.DeleteSearch(search.ID))
+
+	_, err = svc.GetSearch(search.ID)
+	assert.EqualError(t, err, "SAVED_SEARCH_NOT_FOUND")
+}
@@ -0,0 +1,312 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	"github.com/google/go-github/v66/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// Github allows to redeliver a webhook during 3 days, so a delivery ID is kept during this period
+const deliveryRetention = 72 * time.Hour
+
+// Repositories of an installation that can't be refreshed are tried again after a delay, a few times
+const (
+	installationRefreshAttempts   = 3
+	installationRefreshRetryDelay = time.Minute
+)
+
+// Status returned once a webhook has been handled
+const (
+	WebhookStatusProcessed = "processed"
+	WebhookStatusIgnored   = "ignored"
+	WebhookStatusDuplicate = "duplicate"
+)
+
+type WebhookService interface {
+	VerifySignature(signature string, payload []byte) error
+	HandleGithubEvent(ctx context.Context, eventType string, deliveryID string, payload []byte) (string, error)
+}
+
+// State of a delivery in the registry
+const (
+	deliveryNew = iota
+	deliveryInProgress
+	deliveryDone
+)
+
+// deliveryRegistry keeps the delivery IDs processed successfully, to ignore replays of the same delivery,
+// and the ones being processed, to not process the same delivery twice at the same time
+type deliveryRegistry struct {
+	mu         sync.Mutex
+	deliveries map[string]time.Time
+	processing map[string]bool
+}
+
+type webhookService struct {
+	githubService GithubService
+	storage       storage.Storage
+	deliveries    *deliveryRegistry
+	config        config.Config
+
+	// refreshes of installation repositories running in background
+	refreshes  *sync.WaitGroup
+	retryDelay time.Duration
+}
+
+// NewWebhookService will create an instance of WebhookService
+func NewWebhookService(config config.Config, githubService GithubService, storage storage.Storage) WebhookService {
+	return webhookService{
+		githubService: githubService,
+		storage:       storage,
+		deliveries:    &deliveryRegistry{deliveries: make(map[string]time.Time), processing: make(map[string]bool)},
+		config:        config,
+		refreshes:     &sync.WaitGroup{},
+		retryDelay:    installationRefreshRetryDelay,
+	}
+}
+
+// VerifySignature checks the X-Hub-Signature-256 header against the payload, using the configured secret.
+// Only SHA-256 signatures are accepted. If no secret is configured, the webhook is disabled
+func (s webhookService) VerifySignature(signature string, payload []byte) error {
+	if s.config.Github.WebhookSecret == "" {
+		return model.ErrWebhookDisabled
+	}
+
+	if !strings.HasPrefix(signature, "sha256=") {
+		return model.ErrInvalidSignature
+	}
+
+	if err := github.ValidateSignature(signature, payload, []byte(s.config.Github.WebhookSecret)); err != nil {
+		log.WithError(err).Warning("github webhook received with an invalid signature")
+		return model.ErrInvalidSignature.Wrap(err)
+	}
+
+	return nil
+}
+
+// HandleGithubEvent will update repositories according to the event received from Github.
+// A delivery is only considered as received once it has been processed successfully,
+// so Github can redeliver it after a failure
+func (s webhookService) HandleGithubEvent(ctx context.Context, eventType string, deliveryID string, payload []byte) (string, error) {
+	if deliveryID == "" {
+		return "", model.ErrInvalidPayload
+	}
+
+	logger := log.WithContext(ctx).WithFields(log.Fields{
+		"event":      eventType,
+		"deliveryID": deliveryID,
+	})
+
+	switch s.deliveries.begin(deliveryID, time.Now()) {
+	case deliveryDone:
+		logger.Debug("github webhook delivery already processed. ignored")
+		return WebhookStatusDuplicate, nil
+
+	case deliveryInProgress:
+		// not acknowledged, the delivery being processed may still fail
+		logger.Debug("github webhook delivery already being processed")
+		return "", model.ErrDeliveryInProgress
+	}
+
+	event, err := github.ParseWebHook(eventType, payload)
+	if err != nil {
+		s.deliveries.abort(deliveryID)
+
+		// unknown event types are acknowledged, to not be redelivered by Github
+		if strings.Contains(err.Error(), "unknown X-Github-Event") {
+			logger.Debug("unsupported github webhook event. ignored")
+			return WebhookStatusIgnored, nil
+		}
+
+		return "", model.ErrInvalidPayload.Wrap(err)
+	}
+
+	status := WebhookStatusIgnored
+
+	switch e := event.(type) {
+	case *github.RepositoryEvent:
+		status, err = s.handleRepositoryEvent(ctx, e)
+	case *github.PushEvent:
+		status, err = s.handlePushEvent(ctx, e)
+	case *github.InstallationEvent:
+		status, err = s.handleInstallationEvent(ctx, e)
+	}
+
+	if err != nil {
+		s.deliveries.abort(deliveryID)
+		return "", err
+	}
+
+	s.deliveries.done(deliveryID, time.Now())
+	logger.WithField("status", status).Info("github webhook handled")
+	return status, nil
+}
+
+// handleRepositoryEvent keeps repositories and their languages up to date when they are created or changed.
+// Repositories deleted or not public anymore are removed, since this service only exposes public repositories
+func (s webhookService) handleRepositoryEvent(ctx context.Context, e *github.RepositoryEvent) (string, error) {
+	repo, ok := repositoryFromGithub(e.GetRepo())
+	if !ok {
+		return "", model.ErrInvalidPayload
+	}
+
+	switch e.GetAction() {
+	case "created", "edited", "publicized", "renamed", "transferred":
+		if e.GetRepo().GetPrivate() {
+			return WebhookStatusIgnored, nil
+		}
+
+		_, err := s.githubService.RefreshRepository(ctx, repo, e.GetAction() == "created" || e.GetAction() == "publicized")
+		return WebhookStatusProcessed, err
+
+	case "deleted", "privatized":
+		return WebhookStatusProcessed, s.githubService.RemoveRepository(repo)
+	}
+
+	return WebhookStatusIgnored, nil
+}
+
+// handlePushEvent refreshes languages when the default branch changes, because languages are computed on it.
+// Push events don't contain the license, so the stored one is kept
+func (s webhookService) handlePushEvent(ctx context.Context, e *github.PushEvent) (string, error) {
+	pushRepo := e.GetRepo()
+
+	if pushRepo.GetPrivate() || e.GetRef() != "refs/heads/"+pushRepo.GetDefaultBranch() {
+		return WebhookStatusIgnored, nil
+	}
+
+	if pushRepo.ID == nil || pushRepo.FullName == nil || pushRepo.Name == nil || pushRepo.GetOwner().Login == nil {
+		return "", model.ErrInvalidPayload
+	}
+
+	repo := model.GithubRepository{
+		ID:         pushRepo.GetID(),
+		FullName:   pushRepo.GetFullName(),
+		Owner:      pushRepo.GetOwner().GetLogin(),
+		Repository: pushRepo.GetName(),
+	}
+
+	if stored, err := s.storage.GetRepository(repo.FullName); err == nil {
+		repo.License = stored.License
+	}
+
+	_, err := s.githubService.RefreshRepository(ctx, repo, false)
+	return WebhookStatusProcessed, err
+}
+
+// handleInstallationEvent loads all repositories when the Github App is installed on an organization.
+// The installation payload only contains the repositories names, so the license is not known until the next change.
+// Github drops deliveries not answered within 10 seconds, so the delivery is acknowledged and the repositories are loaded in background
+func (s webhookService) handleInstallationEvent(ctx context.Context, e *github.InstallationEvent) (string, error) {
+	if e.GetAction() != "created" && e.GetAction() != "new_permissions_accepted" {
+		return WebhookStatusIgnored, nil
+	}
+
+	repos := make([]model.GithubRepository, 0, len(e.Repositories))
+
+	for _, r := range e.Repositories {
+		owner, name, found := strings.Cut(r.GetFullName(), "/")
+
+		if r.ID == nil || !found || r.GetPrivate() {
+			continue
+		}
+
+		repos = append(repos, model.GithubRepository{
+			ID:         r.GetID(),
+			FullName:   r.GetFullName(),
+			Owner:      owner,
+			Repository: name,
+		})
+	}
+
+	s.refreshes.Add(1)
+	go s.refreshRepositories(context.WithoutCancel(ctx), repos)
+
+	return WebhookStatusProcessed, nil
+}
+
+// refreshRepositories loads the languages of the repositories of an installation. A repository that can't be refreshed
+// doesn't prevent loading the other ones, it's tried again after retryDelay, up to installationRefreshAttempts times
+func (s webhookService) refreshRepositories(ctx context.Context, repos []model.GithubRepository) {
+	defer s.refreshes.Done()
+
+	for attempt := 1; ; attempt++ {
+		failed := make([]model.GithubRepository, 0)
+
+		for _, repo := range repos {
+			if _, err := s.githubService.RefreshRepository(ctx, repo, false); err != nil {
+				log.WithContext(ctx).WithError(err).WithFields(log.Fields{
+					"repository": repo.FullName,
+					"attempt":    attempt,
+				}).Warning("unable to refresh repository of the installation")
+
+				failed = append(failed, repo)
+			}
+		}
+
+		if len(failed) == 0 {
+			return
+		}
+
+		if attempt == installationRefreshAttempts {
+			names := make([]string, 0, len(failed))
+			for _, repo := range failed {
+				names = append(names, repo.FullName)
+			}
+
+			log.WithContext(ctx).WithField("repositories", names).Error("unable to refresh repositories of the installation. they're loaded on their next change")
+			return
+		}
+
+		repos = failed
+		time.Sleep(s.retryDelay)
+	}
+}
+
+// begin registers a delivery as being processed. Returns its previous state, it is only registered if it was new.
+// Deliveries older than the retention period are purged at the same time
+func (r *deliveryRegistry) begin(deliveryID string, now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, processedAt := range r.deliveries {
+		if now.Sub(processedAt) > deliveryRetention {
+			delete(r.deliveries, id)
+		}
+	}
+
+	if _, found := r.deliveries[deliveryID]; found {
+		return deliveryDone
+	}
+
+	if r.processing[deliveryID] {
+		return deliveryInProgress
+	}
+
+	r.processing[deliveryID] = true
+	return deliveryNew
+}
+
+// done marks a delivery as processed successfully, replays will be ignored
+func (r *deliveryRegistry) done(deliveryID string, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.processing, deliveryID)
+	r.deliveries[deliveryID] = now
+}
+
+// abort removes a delivery being processed, so it can be processed again when redelivered
+func (r *deliveryRegistry) abort(deliveryID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.processing, deliveryID)
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/Scalingo/sclng-backend-test-v1/storage"
+	"github.com/google/go-github/v66/github"
+	githubMock "github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+// TestVerifySignature will test function VerifySignature
+func TestVerifySignature(t *testing.T) {
+	payload := []byte(`{"action":"created"}`)
+
+	tests := []struct {
+		name           string
+		secret         string
+		signature      string
+		expectedErrMsg string
+	}{
+		{
+			name:      "Valid signature",
+			secret:    "secret",
+			signature: "sha256=" + SignPayload("secret", payload),
+		},
+		{
+			name:           "Signed with another secret",
+			secret:         "secret",
+			signature:      "sha256=" + SignPayload("other", payload),
+			expectedErrMsg: "INVALID_SIGNATURE",
+		},
+		{
+			name:           "SHA-1 signature refused",
+			secret:         "secret",
+			signature:      "sha1=0123456789abcdef",
+			expectedErrMsg: "INVALID_SIGNATURE",
+		},
+		{
+			name:           "No secret configured",
+			secret:         "",
+			signature:      "sha256=" + SignPayload("", payload),
+			expectedErrMsg: "WEBHOOK_DISABLED",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := config.GetDefault()
+			conf.Github.WebhookSecret = tt.secret
+			svc := NewWebhookService(*conf, nil, storage.NewNoopStorage())
+
+			err := svc.VerifySignature(tt.signature, payload)
+
+			if tt.expectedErrMsg != "" {
+				assert.EqualError(t, err, tt.expectedErrMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestHandleGithubEvent will test function HandleGithubEvent
+func TestHandleGithubEvent(t *testing.T) {
+	brokenCalls := 0
+
+	mockedHTTPClient := githubMock.NewMockedHTTPClient(
+		githubMock.WithRequestMatchHandler(
+			githubMock.GetReposLanguagesByOwnerByRepo,
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.Contains(r.URL.Path, "/broken/") {
+					brokenCalls++
+					githubMock.WriteError(w, http.StatusNotFound, "Not Found")
+					return
+				}
+
+				_, err := w.Write(githubMock.MustMarshal(map[string]int{"Go": 1000}))
+
+				if err != nil {
+					t.Error("unable to configure mock http client")
+				}
+			}),
+		),
+	)
+
+	conf := config.GetDefault()
+	conf.Github.WebhookSecret = "secret"
+	conf.Storage.Path = filepath.Join(t.TempDir(), "storage.db")
+
+	store, err := storage.NewBoltStorage(conf.Storage)
+	if err != nil {
+		t.Fatalf("unable to open storage: %v", err)
+	}
+
+	defer store.Close()
+
+	mockedRateLimiter := rate.NewLimiter(rate.Every(time.Hour), 60)
+	githubService := NewGithubService(*conf, github.NewClient(mockedHTTPClient), mockedRateLimiter, store)
+	svc := NewWebhookService(*conf, githubService, store).(webhookService)
+	svc.retryDelay = 0
+
+	repositoryPayload := func(action string) []byte {
+		return githubMock.MustMarshal(github.RepositoryEvent{
+			Action: github.String(action),
+			Repo: &github.Repository{
+				ID:            github.Int64(42),
+				FullName:      github.String("my-org/my-repo"),
+				Name:          github.String("my-repo"),
+				Owner:         &github.User{Login: github.String("my-org")},
+				License:       &github.License{Key: github.String("mit")},
+				DefaultBranch: github.String("main"),
+			},
+		})
+	}
+
+	// repository created: stored with its languages
+	status, err := svc.HandleGithubEvent(context.Background(), "repository", "delivery-1", repositoryPayload("created"))
+	assert.NoError(t, err)
+	assert.Equal(t, WebhookStatusProcessed, status)
+
+	stored, err := store.GetRepository("my-org/my-repo")
+	assert.NoError(t, err)
+	assert.Equal(t, "mit", stored.License)
+	assert.Equal(t, map[string]int{"Go": 1000}, stored.Languages)
+
+	// same delivery replayed: ignored
+	status, err = svc.HandleGithubEvent(context.Background(), "repository", "delivery-1", repositoryPayload("deleted"))
+	assert.NoError(t, err)
+	assert.Equal(t, WebhookStatusDuplicate, status)
+
+	_, err = store.GetRepository("my-org/my-repo")
+	assert.NoError(t, err)
+
+	// push on another branch than the default one: ignored
+	pushPayload := githubMock.MustMarshal(github.PushEvent{
+		Ref: github.String("refs/heads/feature"),
+		Repo: &github.PushEventRepository{
+			ID:            github.Int64(42),
+			FullName:      github.String("my-org/my-repo"),
+			Name:          github.String("my-repo"),
+			Owner:         &github.User{Login: github.String("my-org")},
+			DefaultBranch: github.String("main"),
+		},
+	})
+
+	status, err = svc.HandleGithubEvent(context.Background(), "push", "delivery-2", pushPayload)
+	assert.NoError(t, err)
+	assert.Equal(t, WebhookStatusIgnored, status)
+
+	// unsupported events are acknowledged
+	status, err = svc.HandleGithubEvent(context.Background(), "unknown_event", "delivery-3", []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, WebhookStatusIgnored, status)
+
+	// repository deleted: removed from storage
+	status, err = svc.HandleGithubEvent(context.Background(), "repository", "delivery-4", repositoryPayload("deleted"))
+	assert.NoError(t, err)
+	assert.Equal(t, WebhookStatusProcessed, status)
+
+	_, err = store.GetRepository("my-org/my-repo")
+	assert.ErrorIs(t, err, storage.ErrRepositoryNotFound)
+
+	// installation created: all repositories are loaded, even after a repository that can't be refreshed
+	installationPayload := githubMock.MustMarshal(github.InstallationEvent{
+		Action: github.String("created"),
+		Repositories: []*github.Repository{
+			{ID: github.Int64(45), FullName: github.String("broken/repo")},
+			{ID: github.Int64(43), FullName: github.String("my-org/first")},
+			{ID: github.Int64(44), FullName: github.String("my-org/second")},
+		},
+	})
+
+	// the delivery is acknowledged at once, the repositories are loaded in background
+	status, err = svc.HandleGithubEvent(context.Background(), "installation", "delivery-5", installationPayload)
+	assert.NoError(t, err)
+	assert.Equal(t, WebhookStatusProcessed, status)
+
+	svc.refreshes.Wait()
+
+	// the repository that can't be refreshed is tried again
+	assert.Equal(t, installationRefreshAttempts, brokenCalls)
+
+	for _, fullName := range []string{"my-org/first", "my-org/second"} {
+		stored, err = store.GetRepository(fullName)
+		assert.NoError(t, err)
+		assert.Equal(t, model.GithubRepository{
+			ID:               stored.ID,
+			FullName:         fullName,
+			Owner:            "my-org",
+			Repository:       stored.Repository,
+			MostUsedLanguage: github.String("Go"),
+			Languages:        map[string]int{"Go": 1000},
+		}, stored)
+	}
+}
+
+// TestDeliveryRegistry checks that a delivery is only ignored once processed successfully
+func TestDeliveryRegistry(t *testing.T) {
+	registry := &deliveryRegistry{deliveries: make(map[string]time.Time), processing: make(map[string]bool)}
+	now := time.Now()
+
+	assert.Equal(t, deliveryNew, registry.begin("delivery-1", now))
+	assert.Equal(t, deliveryInProgress, registry.begin("delivery-1", now))
+
+	registry.abort("delivery-1")
+	assert.Equal(t, deliveryNew, registry.begin("delivery-1", now))
+
+	registry.done("delivery-1", now)
+	assert.Equal(t, deliveryDone, registry.begin("delivery-1", now))
+
+	// forgotten after the retention period, Github doesn't redeliver it anymore
+	assert.Equal(t, deliveryNew, registry.begin("delivery-1", now.Add(deliveryRetention+time.Minute)))
+}
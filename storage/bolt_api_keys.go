@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	bolt "go.etcd.io/bbolt"
+)
+
+// apiKeyRecord is the stored version of an API key, indexed by its hash.
+// APIKey can't be stored directly because the hash is ignored from json
+type apiKeyRecord struct {
+	Name            string    `json:"name"`
+	Hash            string    `json:"hash"`
+	RequestsPerHour int       `json:"requestsPerHour"`
+	Admin           bool      `json:"admin"`
+	Lane            string    `json:"lane,omitempty"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+func (r apiKeyRecord) toModel() model.APIKey {
+	return model.APIKey{
+		Name:            r.Name,
+		Hash:            r.Hash,
+		RequestsPerHour: r.RequestsPerHour,
+		Admin:           r.Admin,
+		Lane:            r.Lane,
+		Source:          model.APIKeySourceStorage,
+		CreatedAt:       r.CreatedAt,
+	}
+}
+
+// SaveAPIKey will create or replace an API key
+func (s boltStorage) SaveAPIKey(key model.APIKey) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		v, err := json.Marshal(apiKeyRecord{
+			Name:            key.Name,
+			Hash:            key.Hash,
+			RequestsPerHour: key.RequestsPerHour,
+			Admin:           key.Admin,
+			Lane:            key.Lane,
+			CreatedAt:       key.CreatedAt,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(apiKeysBucket).Put([]byte(key.Hash), v)
+	})
+}
+
+// GetAPIKey returns an API key using the hash of the key
+func (s boltStorage) GetAPIKey(hash string) (model.APIKey, error) {
+	var record apiKeyRecord
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(apiKeysBucket).Get([]byte(hash))
+		if v == nil {
+			return ErrAPIKeyNotFound
+		}
+
+		return json.Unmarshal(v, &record)
+	})
+
+	if err != nil {
+		return model.APIKey{}, err
+	}
+
+	return record.toModel(), nil
+}
+
+// ListAPIKeys returns all API keys, sorted by hash
+func (s boltStorage) ListAPIKeys() ([]model.APIKey, error) {
+	keys := make([]model.APIKey, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(apiKeysBucket).ForEach(func(_, v []byte) error {
+			var record apiKeyRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+
+			keys = append(keys, record.toModel())
+			return nil
+		})
+	})
+
+	return keys, err
+}
+
+// DeleteAPIKey will delete an API key using its name
+func (s boltStorage) DeleteAPIKey(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(apiKeysBucket)
+		cursor := bucket.Cursor()
+
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			var record apiKeyRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+
+			if record.Name == name {
+				return bucket.Delete(k)
+			}
+		}
+
+		return ErrAPIKeyNotFound
+	})
+}
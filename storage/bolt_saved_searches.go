@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	bolt "go.etcd.io/bbolt"
+)
+
+// SaveSearch will create or replace a saved search
+func (s boltStorage) SaveSearch(search model.SavedSearch) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		v, err := json.Marshal(search)
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(savedSearchesBucket).Put([]byte(search.ID), v)
+	})
+}
+
+// GetSearch returns a saved search using its ID
+func (s boltStorage) GetSearch(id string) (model.SavedSearch, error) {
+	var search model.SavedSearch
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(savedSearchesBucket).Get([]byte(id))
+		if v == nil {
+			return ErrSavedSearchNotFound
+		}
+
+		return json.Unmarshal(v, &search)
+	})
+
+	return search, err
+}
+
+// ListSearches returns all saved searches, sorted by ID
+func (s boltStorage) ListSearches() ([]model.SavedSearch, error) {
+	searches := make([]model.SavedSearch, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(savedSearchesBucket).ForEach(func(_, v []byte) error {
+			var search model.SavedSearch
+			if err := json.Unmarshal(v, &search); err != nil {
+				return err
+			}
+
+			searches = append(searches, search)
+			return nil
+		})
+	})
+
+	return searches, err
+}
+
+// DeleteSearch will delete a saved search and the repositories already seen for it
+func (s boltStorage) DeleteSearch(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(savedSearchesBucket).Get([]byte(id)) == nil {
+			return ErrSavedSearchNotFound
+		}
+
+		if err := tx.Bucket(savedSearchesBucket).Delete([]byte(id)); err != nil {
+			return err
+		}
+
+		if tx.Bucket(seenRepositoriesBucket).Bucket([]byte(id)) == nil {
+			return nil
+		}
+
+		return tx.Bucket(seenRepositoriesBucket).DeleteBucket([]byte(id))
+	})
+}
+
+// MarkSearchRun will update the last run date of a saved search.
+// Done in a single transaction, to not override changes made on the search while it was running
+func (s boltStorage) MarkSearchRun(id string, runAt time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		v := tx.Bucket(savedSearchesBucket).Get([]byte(id))
+		if v == nil {
+			return ErrSavedSearchNotFound
+		}
+
+		var search model.SavedSearch
+		if err := json.Unmarshal(v, &search); err != nil {
+			return err
+		}
+
+		search.LastRunAt = &runAt
+
+		updated, err := json.Marshal(search)
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(savedSearchesBucket).Put([]byte(id), updated)
+	})
+}
+
+// UnseenRepositories returns the repositories never seen before for the saved search, without marking them as seen
+func (s boltStorage) UnseenRepositories(searchID string, repositoryIDs []int64) ([]int64, error) {
+	unseen := make([]int64, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		seen := tx.Bucket(seenRepositoriesBucket).Bucket([]byte(searchID))
+
+		for _, id := range repositoryIDs {
+			if seen == nil || seen.Get(itob(id)) == nil {
+				unseen = append(unseen, id)
+			}
+		}
+
+		return nil
+	})
+
+	return unseen, err
+}
+
+// MarkRepositoriesSeen will keep the repositories as seen for the saved search, with the date they were last seen
+// so the ones no longer matching the search are deleted by the retention.
+// Returns the repositories that were never seen before for this search
+func (s boltStorage) MarkRepositoriesSeen(searchID string, repositoryIDs []int64, seenAt time.Time) ([]int64, error) {
+	unseen := make([]int64, 0)
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		seen, err := tx.Bucket(seenRepositoriesBucket).CreateBucketIfNotExists([]byte(searchID))
+		if err != nil {
+			return err
+		}
+
+		for _, id := range repositoryIDs {
+			if seen.Get(itob(id)) == nil {
+				unseen = append(unseen, id)
+			}
+
+			if err := seen.Put(itob(id), itob(seenAt.UnixNano())); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return unseen, err
+}
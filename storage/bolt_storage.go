@@ -0,0 +1,411 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// repositoryRecord is the stored version of a repository.
+// GithubRepository can't be stored directly because some fields are ignored from json
+type repositoryRecord struct {
+	ID               int64          `json:"id"`
+	FullName         string         `json:"fullName"`
+	Owner            string         `json:"owner"`
+	Repository       string         `json:"repository"`
+	License          string         `json:"license"`
+	MostUsedLanguage *string        `json:"mostUsedLanguage"`
+	Languages        map[string]int `json:"languages"`
+	FirstSeenAt      time.Time      `json:"firstSeenAt"`
+	LastSeenAt       time.Time      `json:"lastSeenAt"`
+}
+
+type boltStorage struct {
+	db     *bolt.DB
+	config config.StorageConfig
+}
+
+// NewBoltStorage will open (or create) the database file and apply the schema migrations
+func NewBoltStorage(config config.StorageConfig) (Storage, error) {
+	if err := os.MkdirAll(filepath.Dir(config.Path), 0o750); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(config.Path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return boltStorage{
+		db:     db,
+		config: config,
+	}, nil
+}
+
+// SaveRepositories will store or update all repositories.
+// A languages snapshot is added only if languages have been loaded and changed since the last snapshot,
+// so the history only contains the changes and not every fetch
+func (s boltStorage) SaveRepositories(repositories []model.GithubRepository, fetchedAt time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, r := range repositories {
+			record := repositoryRecord{
+				ID:               r.ID,
+				FullName:         r.FullName,
+				Owner:            r.Owner,
+				Repository:       r.Repository,
+				License:          r.License,
+				MostUsedLanguage: r.MostUsedLanguage,
+				Languages:        r.Languages,
+				FirstSeenAt:      fetchedAt,
+				LastSeenAt:       fetchedAt,
+			}
+
+			existing, found, err := getRecord(tx, r.ID)
+			if err != nil {
+				return err
+			}
+
+			if found {
+				record.FirstSeenAt = existing.FirstSeenAt
+
+				// repository renamed or transferred, the previous name must not be found anymore
+				if !strings.EqualFold(existing.FullName, record.FullName) {
+					if err := tx.Bucket(repositoriesByNameBucket).Delete([]byte(strings.ToLower(existing.FullName))); err != nil {
+						return err
+					}
+				}
+
+				// languages not loaded this time, keep the previous ones
+				if record.Languages == nil {
+					record.Languages = existing.Languages
+				}
+			}
+
+			if err := putRecord(tx, record); err != nil {
+				return err
+			}
+
+			if r.Languages != nil {
+				if err := putSnapshotIfChanged(tx, r.ID, model.LanguagesSnapshot{FetchedAt: fetchedAt, Languages: r.Languages}); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetRepository returns the last known version of a repository using its full name (case insensitive)
+func (s boltStorage) GetRepository(fullName string) (model.GithubRepository, error) {
+	var repository model.GithubRepository
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		id := tx.Bucket(repositoriesByNameBucket).Get([]byte(strings.ToLower(fullName)))
+		if id == nil {
+			return ErrRepositoryNotFound
+		}
+
+		record, found, err := getRecord(tx, int64(binary.BigEndian.Uint64(id)))
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			return ErrRepositoryNotFound
+		}
+
+		repository = model.GithubRepository{
+			ID:               record.ID,
+			FullName:         record.FullName,
+			Owner:            record.Owner,
+			Repository:       record.Repository,
+			License:          record.License,
+			MostUsedLanguage: record.MostUsedLanguage,
+			Languages:        record.Languages,
+		}
+
+		return nil
+	})
+
+	return repository, err
+}
+
+// GetLanguagesSnapshots returns all languages snapshots of a repository, from the oldest to the most recent
+func (s boltStorage) GetLanguagesSnapshots(fullName string) ([]model.LanguagesSnapshot, error) {
+	snapshots := make([]model.LanguagesSnapshot, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		id := tx.Bucket(repositoriesByNameBucket).Get([]byte(strings.ToLower(fullName)))
+		if id == nil {
+			return ErrRepositoryNotFound
+		}
+
+		repositorySnapshots := tx.Bucket(snapshotsBucket).Bucket(id)
+		if repositorySnapshots == nil {
+			return nil
+		}
+
+		return repositorySnapshots.ForEach(func(_, v []byte) error {
+			var snapshot model.LanguagesSnapshot
+			if err := json.Unmarshal(v, &snapshot); err != nil {
+				return err
+			}
+
+			snapshots = append(snapshots, snapshot)
+			return nil
+		})
+	})
+
+	return snapshots, err
+}
+
+// DeleteRepository will delete a repository and all its languages snapshots.
+// Deleting an unknown repository is not an error
+func (s boltStorage) DeleteRepository(repositoryID int64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		record, found, err := getRecord(tx, repositoryID)
+		if err != nil || !found {
+			return err
+		}
+
+		return deleteRecord(tx, record)
+	})
+}
+
+// ApplyRetention will delete repositories not seen since the retention period with all their snapshots.
+// For other repositories, snapshots older than the retention period are deleted, except the most recent one
+// because it still describes the current languages. Repositories not seen by a saved search since the retention period
+// are deleted too, they no longer match it. Returns the number of deleted entries
+func (s boltStorage) ApplyRetention(now time.Time) (int, error) {
+	if s.config.RetentionDays <= 0 {
+		return 0, nil
+	}
+
+	limit := now.Add(-time.Duration(s.config.RetentionDays) * 24 * time.Hour)
+	deleted := 0
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		repositories := tx.Bucket(repositoriesBucket)
+		snapshots := tx.Bucket(snapshotsBucket)
+
+		// Collect keys before deleting, bolt doesn't support updates while iterating
+		expiredRepositories := make([]repositoryRecord, 0)
+
+		err := repositories.ForEach(func(_, v []byte) error {
+			var record repositoryRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+
+			if record.LastSeenAt.Before(limit) {
+				expiredRepositories = append(expiredRepositories, record)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for _, record := range expiredRepositories {
+			if err := deleteRecord(tx, record); err != nil {
+				return err
+			}
+
+			deleted++
+		}
+
+		err = snapshots.ForEachBucket(func(id []byte) error {
+			repositorySnapshots := snapshots.Bucket(id)
+			lastKey, _ := repositorySnapshots.Cursor().Last()
+			expiredSnapshots := make([][]byte, 0)
+
+			err := repositorySnapshots.ForEach(func(k, _ []byte) error {
+				if string(k) != string(lastKey) && time.Unix(0, int64(binary.BigEndian.Uint64(k))).Before(limit) {
+					expiredSnapshots = append(expiredSnapshots, k)
+				}
+
+				return nil
+			})
+
+			if err != nil {
+				return err
+			}
+
+			for _, k := range expiredSnapshots {
+				if err := repositorySnapshots.Delete(k); err != nil {
+					return err
+				}
+
+				deleted++
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		deletedSeen, err := deleteExpiredSeenRepositories(tx, limit)
+		deleted += deletedSeen
+
+		return err
+	})
+
+	return deleted, err
+}
+
+// deleteExpiredSeenRepositories deletes the repositories not seen by a saved search since the limit
+func deleteExpiredSeenRepositories(tx *bolt.Tx, limit time.Time) (int, error) {
+	deleted := 0
+
+	err := tx.Bucket(seenRepositoriesBucket).ForEachBucket(func(searchID []byte) error {
+		seen := tx.Bucket(seenRepositoriesBucket).Bucket(searchID)
+		expired := make([][]byte, 0)
+
+		err := seen.ForEach(func(k, v []byte) error {
+			if len(v) == 8 && time.Unix(0, int64(binary.BigEndian.Uint64(v))).Before(limit) {
+				expired = append(expired, k)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			if err := seen.Delete(k); err != nil {
+				return err
+			}
+
+			deleted++
+		}
+
+		return nil
+	})
+
+	return deleted, err
+}
+
+// RunRetention will apply the retention policy at each interval until the context is cancelled
+func (s boltStorage) RunRetention(ctx context.Context, interval time.Duration) {
+	for {
+		deleted, err := s.ApplyRetention(time.Now())
+
+		if err != nil {
+			log.WithError(err).Error("unable to apply storage retention policy")
+		} else {
+			log.WithField("deletedEntries", deleted).Debug("storage retention policy applied")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Ping checks that the database can still be read
+func (s boltStorage) Ping() error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(repositoriesBucket) == nil {
+			return errors.New("repositories bucket not found")
+		}
+
+		return nil
+	})
+}
+
+// Close will close the database file
+func (s boltStorage) Close() error {
+	return s.db.Close()
+}
+
+func getRecord(tx *bolt.Tx, id int64) (repositoryRecord, bool, error) {
+	var record repositoryRecord
+
+	v := tx.Bucket(repositoriesBucket).Get(itob(id))
+	if v == nil {
+		return record, false, nil
+	}
+
+	err := json.Unmarshal(v, &record)
+	return record, err == nil, err
+}
+
+func putRecord(tx *bolt.Tx, record repositoryRecord) error {
+	v, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Bucket(repositoriesBucket).Put(itob(record.ID), v); err != nil {
+		return err
+	}
+
+	return tx.Bucket(repositoriesByNameBucket).Put([]byte(strings.ToLower(record.FullName)), itob(record.ID))
+}
+
+func deleteRecord(tx *bolt.Tx, record repositoryRecord) error {
+	if err := tx.Bucket(repositoriesBucket).Delete(itob(record.ID)); err != nil {
+		return err
+	}
+
+	if err := tx.Bucket(repositoriesByNameBucket).Delete([]byte(strings.ToLower(record.FullName))); err != nil {
+		return err
+	}
+
+	if tx.Bucket(snapshotsBucket).Bucket(itob(record.ID)) == nil {
+		return nil
+	}
+
+	return tx.Bucket(snapshotsBucket).DeleteBucket(itob(record.ID))
+}
+
+// putSnapshotIfChanged adds the snapshot only if languages are different from the most recent snapshot
+func putSnapshotIfChanged(tx *bolt.Tx, id int64, snapshot model.LanguagesSnapshot) error {
+	repositorySnapshots, err := tx.Bucket(snapshotsBucket).CreateBucketIfNotExists(itob(id))
+	if err != nil {
+		return err
+	}
+
+	if _, last := repositorySnapshots.Cursor().Last(); last != nil {
+		var lastSnapshot model.LanguagesSnapshot
+		if err := json.Unmarshal(last, &lastSnapshot); err != nil {
+			return err
+		}
+
+		if maps.Equal(lastSnapshot.Languages, snapshot.Languages) {
+			return nil
+		}
+	}
+
+	v, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	return repositorySnapshots.Put(itob(snapshot.FetchedAt.UnixNano()), v)
+}
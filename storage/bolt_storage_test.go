@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/config"
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestStorage will create a bolt storage in a temporary directory
+func newTestStorage(t *testing.T, retentionDays int) (Storage, config.StorageConfig) {
+	conf := config.StorageConfig{
+		Enabled:       true,
+		Path:          filepath.Join(t.TempDir(), "data", "storage.db"),
+		RetentionDays: retentionDays,
+	}
+
+	store, err := NewBoltStorage(conf)
+	if err != nil {
+		t.Fatalf("unable to open storage: %v", err)
+	}
+
+	return store, conf
+}
+
+// TestSaveRepositories will test function SaveRepositories and the languages snapshots history
+func TestSaveRepositories(t *testing.T) {
+	store, conf := newTestStorage(t, 30)
+	now := time.Now()
+
+	repo := model.GithubRepository{ID: 1, FullName: "Owner1/repo1", Owner: "Owner1", Repository: "repo1", Languages: map[string]int{"Go": 100}}
+	assert.NoError(t, store.SaveRepositories([]model.GithubRepository{repo}, now.Add(-2*time.Hour)))
+
+	// same languages, no new snapshot
+	assert.NoError(t, store.SaveRepositories([]model.GithubRepository{repo}, now.Add(-time.Hour)))
+
+	// languages not loaded, no new snapshot and previous languages kept
+	repo.Languages = nil
+	assert.NoError(t, store.SaveRepositories([]model.GithubRepository{repo}, now.Add(-30*time.Minute)))
+
+	repo.Languages = map[string]int{"Go": 150, "Shell": 10}
+	assert.NoError(t, store.SaveRepositories([]model.GithubRepository{repo}, now))
+
+	stored, err := store.GetRepository("owner1/REPO1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), stored.ID)
+	assert.Equal(t, map[string]int{"Go": 150, "Shell": 10}, stored.Languages)
+
+	snapshots, err := store.GetLanguagesSnapshots("owner1/repo1")
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, 2)
+	assert.Equal(t, map[string]int{"Go": 100}, snapshots[0].Languages)
+	assert.True(t, snapshots[0].FetchedAt.Equal(now.Add(-2*time.Hour)))
+	assert.Equal(t, map[string]int{"Go": 150, "Shell": 10}, snapshots[1].Languages)
+
+	_, err = store.GetRepository("unknown/repo")
+	assert.ErrorIs(t, err, ErrRepositoryNotFound)
+
+	// data must be kept when the database is opened again
+	assert.NoError(t, store.Close())
+	store, err = NewBoltStorage(conf)
+	assert.NoError(t, err)
+	defer store.Close()
+
+	snapshots, err = store.GetLanguagesSnapshots("owner1/repo1")
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, 2)
+}
+
+// TestApplyRetention will test function ApplyRetention
+func TestApplyRetention(t *testing.T) {
+	store, _ := newTestStorage(t, 10)
+	defer store.Close()
+
+	now := time.Now()
+
+	// repository 1 not seen since retention period, must be deleted
+	// repository 2 seen recently, only the oldest snapshot must be deleted
+	// repository 3 has a single old snapshot, it must be kept because it's the most recent one
+	assert.NoError(t, store.SaveRepositories([]model.GithubRepository{
+		{ID: 1, FullName: "owner/repo1", Languages: map[string]int{"Go": 1}},
+		{ID: 2, FullName: "owner/repo2", Languages: map[string]int{"Go": 1}},
+		{ID: 3, FullName: "owner/repo3", Languages: map[string]int{"Go": 1}},
+	}, now.Add(-20*24*time.Hour)))
+
+	assert.NoError(t, store.SaveRepositories([]model.GithubRepository{
+		{ID: 2, FullName: "owner/repo2", Languages: map[string]int{"Go": 2}},
+		{ID: 3, FullName: "owner/repo3", Languages: map[string]int{"Go": 1}},
+	}, now.Add(-24*time.Hour)))
+
+	// repository 1 no longer matches the saved search, it must be forgotten
+	_, err := store.MarkRepositoriesSeen("search", []int64{1, 2}, now.Add(-20*24*time.Hour))
+	assert.NoError(t, err)
+	unseen, err := store.MarkRepositoriesSeen("search", []int64{2}, now.Add(-24*time.Hour))
+	assert.NoError(t, err)
+	assert.Empty(t, unseen)
+
+	deleted, err := store.ApplyRetention(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, deleted)
+
+	unseen, err = store.UnseenRepositories("search", []int64{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1}, unseen)
+
+	_, err = store.GetRepository("owner/repo1")
+	assert.ErrorIs(t, err, ErrRepositoryNotFound)
+
+	snapshots, err := store.GetLanguagesSnapshots("owner/repo2")
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, 1)
+	assert.Equal(t, map[string]int{"Go": 2}, snapshots[0].Languages)
+
+	snapshots, err = store.GetLanguagesSnapshots("owner/repo3")
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, 1)
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	metaBucket               = []byte("meta")
+	repositoriesBucket       = []byte("repositories")
+	repositoriesByNameBucket = []byte("repositoriesByName")
+	snapshotsBucket          = []byte("languagesSnapshots")
+	savedSearchesBucket      = []byte("savedSearches")
+	seenRepositoriesBucket   = []byte("savedSearchesSeenRepositories")
+	apiKeysBucket            = []byte("apiKeys")
+
+	schemaVersionKey = []byte("schemaVersion")
+)
+
+// migrations to apply in order to the database schema. The schema version is the number of migrations applied.
+// Never edit or remove an existing migration, always add a new one at the end of the list
+var migrations = []func(tx *bolt.Tx) error{
+	// 1: repositories indexed by ID and full name, languages snapshots in a sub bucket per repository
+	func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{repositoriesBucket, repositoriesByNameBucket, snapshotsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+
+	// 2: saved searches, with the repositories already seen in a sub bucket per search
+	func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{savedSearchesBucket, seenRepositoriesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+
+	// 3: API keys created through the API, indexed by the hash of the key
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(apiKeysBucket)
+		return err
+	},
+
+	// 4: repositories seen by saved searches keep the date they were last seen, so they can be pruned by the retention.
+	// Repositories seen before are considered seen when the migration is applied
+	func(tx *bolt.Tx) error {
+		seenAt := itob(time.Now().UnixNano())
+
+		return tx.Bucket(seenRepositoriesBucket).ForEachBucket(func(searchID []byte) error {
+			seen := tx.Bucket(seenRepositoriesBucket).Bucket(searchID)
+			ids := make([][]byte, 0)
+
+			err := seen.ForEach(func(k, _ []byte) error {
+				ids = append(ids, k)
+				return nil
+			})
+
+			if err != nil {
+				return err
+			}
+
+			for _, id := range ids {
+				if err := seen.Put(id, seenAt); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	},
+}
+
+// migrate will apply all migrations not applied yet, in a single transaction
+func migrate(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+
+		currentVersion := 0
+		if v := meta.Get(schemaVersionKey); v != nil {
+			currentVersion = int(binary.BigEndian.Uint64(v))
+		}
+
+		if currentVersion > len(migrations) {
+			return fmt.Errorf("database schema version %d is newer than the application one %d", currentVersion, len(migrations))
+		}
+
+		for version := currentVersion; version < len(migrations); version++ {
+			log.WithField("schemaVersion", version+1).Info("apply storage migration")
+
+			if err := migrations[version](tx); err != nil {
+				return fmt.Errorf("migration %d failed: %w", version+1, err)
+			}
+		}
+
+		return meta.Put(schemaVersionKey, itob(int64(len(migrations))))
+	})
+}
+
+// itob returns an 8-byte big endian representation of v, to keep keys sorted
+func itob(v int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(v))
+	return b
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+)
+
+var (
+	ErrRepositoryNotFound  = fmt.Errorf("REPOSITORY_NOT_FOUND")
+	ErrSavedSearchNotFound = fmt.Errorf("SAVED_SEARCH_NOT_FOUND")
+	ErrAPIKeyNotFound      = fmt.Errorf("API_KEY_NOT_FOUND")
+)
+
+// Storage keeps every repository fetched from Github and the history of their languages
+type Storage interface {
+	SaveRepositories(repositories []model.GithubRepository, fetchedAt time.Time) error
+	GetRepository(fullName string) (model.GithubRepository, error)
+	GetLanguagesSnapshots(fullName string) ([]model.LanguagesSnapshot, error)
+	DeleteRepository(repositoryID int64) error
+
+	SaveSearch(search model.SavedSearch) error
+	GetSearch(id string) (model.SavedSearch, error)
+	ListSearches() ([]model.SavedSearch, error)
+	DeleteSearch(id string) error
+	MarkSearchRun(id string, runAt time.Time) error
+	UnseenRepositories(searchID string, repositoryIDs []int64) ([]int64, error)
+	MarkRepositoriesSeen(searchID string, repositoryIDs []int64, seenAt time.Time) ([]int64, error)
+
+	SaveAPIKey(key model.APIKey) error
+	GetAPIKey(hash string) (model.APIKey, error)
+	ListAPIKeys() ([]model.APIKey, error)
+	DeleteAPIKey(name string) error
+
+	ApplyRetention(now time.Time) (int, error)
+	RunRetention(ctx context.Context, interval time.Duration)
+	Ping() error
+	Close() error
+}
+
+type noopStorage struct{}
+
+// NewNoopStorage will create a storage that keeps nothing, used when storage is disabled in config
+func NewNoopStorage() Storage {
+	return noopStorage{}
+}
+
+func (s noopStorage) SaveRepositories(_ []model.GithubRepository, _ time.Time) error {
+	return nil
+}
+
+func (s noopStorage) GetRepository(_ string) (model.GithubRepository, error) {
+	return model.GithubRepository{}, ErrRepositoryNotFound
+}
+
+func (s noopStorage) GetLanguagesSnapshots(_ string) ([]model.LanguagesSnapshot, error) {
+	return []model.LanguagesSnapshot{}, ErrRepositoryNotFound
+}
+
+func (s noopStorage) DeleteRepository(_ int64) error {
+	return nil
+}
+
+func (s noopStorage) SaveSearch(_ model.SavedSearch) error {
+	return nil
+}
+
+func (s noopStorage) GetSearch(_ string) (model.SavedSearch, error) {
+	return model.SavedSearch{}, ErrSavedSearchNotFound
+}
+
+func (s noopStorage) ListSearches() ([]model.SavedSearch, error) {
+	return []model.SavedSearch{}, nil
+}
+
+func (s noopStorage) DeleteSearch(_ string) error {
+	return ErrSavedSearchNotFound
+}
+
+func (s noopStorage) MarkSearchRun(_ string, _ time.Time) error {
+	return ErrSavedSearchNotFound
+}
+
+func (s noopStorage) UnseenRepositories(_ string, _ []int64) ([]int64, error) {
+	return []int64{}, nil
+}
+
+func (s noopStorage) MarkRepositoriesSeen(_ string, _ []int64, _ time.Time) ([]int64, error) {
+	return []int64{}, nil
+}
+
+func (s noopStorage) SaveAPIKey(_ model.APIKey) error {
+	return nil
+}
+
+func (s noopStorage) GetAPIKey(_ string) (model.APIKey, error) {
+	return model.APIKey{}, ErrAPIKeyNotFound
+}
+
+func (s noopStorage) ListAPIKeys() ([]model.APIKey, error) {
+	return []model.APIKey{}, nil
+}
+
+func (s noopStorage) DeleteAPIKey(_ string) error {
+	return ErrAPIKeyNotFound
+}
+
+func (s noopStorage) ApplyRetention(_ time.Time) (int, error) {
+	return 0, nil
+}
+
+func (s noopStorage) RunRetention(_ context.Context, _ time.Duration) {}
+
+func (s noopStorage) Ping() error {
+	return nil
+}
+
+func (s noopStorage) Close() error {
+	return nil
+}
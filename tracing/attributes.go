@@ -0,0 +1,23 @@
+package tracing
+
+import (
+	"github.com/Scalingo/sclng-backend-test-v1/model"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// QueryAttributes returns the filters of a search as span attributes
+func QueryAttributes(searchQuery model.SearchQuery) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("query.owner", searchQuery.Owner),
+		attribute.String("query.license", searchQuery.License),
+		attribute.String("query.language", searchQuery.Language),
+	}
+}
+
+// RepositoryAttributes returns the identity of a repository as span attributes
+func RepositoryAttributes(repository model.GithubRepository) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int64("repository.id", repository.ID),
+		attribute.String("repository.full_name", repository.FullName),
+	}
+}